@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,23 +25,40 @@ func (a Address) URL() (*url.URL, error) {
 	return url.Parse(string(a))
 }
 
+// Redacted returns the address with any password replaced, so it can be shown
+func (a Address) Redacted() Address {
+	u, err := a.URL()
+	if err != nil || u.User == nil {
+		return a
+	}
+
+	return Address(u.Redacted())
+}
+
 // HTTPMonitorConfiguration defines the management website configuration
 type HTTPMonitorConfiguration struct {
 	Enabled bool              `yaml:"enabled"`
 	Path    string            `yaml:"path"`
 	Address Address           `yaml:"address"`
 	TLS     *TLSConfiguration `yaml:"tls"`
+	History struct {
+		Size    int           `yaml:"size"`
+		Slowest int           `yaml:"slowest"`
+		Window  time.Duration `yaml:"window"`
+	} `yaml:"history"`
 }
 
 // LoggingConfiguration defines the logging interface and outputs
 type LoggingConfiguration struct {
-	ParseRealIP bool `yaml:"real_ip"`
+	ParseRealIP bool   `yaml:"real_ip"`
+	Level       string `yaml:"level"`
 	Outputs     struct {
 		Stdout struct {
 			Format string `yaml:"format"`
 		} `yaml:"std"`
 		Systemd struct {
-			Format string `yaml:"format"`
+			Format  string `yaml:"format"`
+			Journal bool   `yaml:"journal"`
 		} `yaml:"systemd"`
 		Syslog struct {
 			Address        Address `yaml:"address"`
@@ -52,9 +70,23 @@ type LoggingConfiguration struct {
 				Values map[string]string `yaml:"values"`
 			} `yaml:"data"`
 		} `yaml:"syslog"`
+		File struct {
+			Path    string        `yaml:"path"`
+			Format  string        `yaml:"format"`
+			MaxSize int64         `yaml:"max_size"`
+			MaxAge  time.Duration `yaml:"max_age"`
+			Keep    int           `yaml:"keep"`
+		} `yaml:"file"`
 	} `yaml:"outputs"`
 }
 
+// TracingConfiguration defines where the request traces are sent
+type TracingConfiguration struct {
+	Address     Address       `yaml:"address"`
+	ServiceName string        `yaml:"service_name"`
+	Interval    time.Duration `yaml:"interval"`
+}
+
 // MetricsConfiguration defines the metrics reporting formatting and outputs
 type MetricsConfiguration struct {
 	Prefix   string `yaml:"prefix"`
@@ -64,10 +96,16 @@ type MetricsConfiguration struct {
 		Path   bool `yaml:"path"`
 		Method bool `yaml:"method"`
 	} `yaml:"includes"`
-	TagSets map[string]string `yaml:"tag_sets"`
-	Tags    []string          `yaml:"tags"`
-	Address Address           `yaml:"address"`
-	Format  string            `yaml:"format"`
+	TagSets  map[string]string `yaml:"tag_sets"`
+	Tags     []string          `yaml:"tags"`
+	Address  Address           `yaml:"address"`
+	Format   string            `yaml:"format"`
+	Interval time.Duration     `yaml:"interval"`
+
+	Prometheus struct {
+		Enabled bool      `yaml:"enabled"`
+		Buckets []float64 `yaml:"buckets"`
+	} `yaml:"prometheus"`
 }
 
 // SiteConfiguration defines the hosted site
@@ -76,11 +114,13 @@ type SiteConfiguration struct {
 		IncludeServer    bool              `yaml:"server"`
 		Blacklist        []string          `yaml:"strip"`
 		IncludeRequestID bool              `yaml:"request_id"`
+		TrustRequestID   bool              `yaml:"request_id_trust"`
 		ExtraHeaders     map[string]string `yaml:"append"`
 		IncludeDebug     bool              `yaml:"debug"`
 	} `yaml:"headers"`
-	Hosts   []string `yaml:"hosts"`
-	Content struct {
+	Hosts          []string `yaml:"hosts"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	Content        struct {
 		Path                            string            `yaml:"path"`
 		DefaultDocument                 string            `yaml:"default"`
 		EnableSinglePageApplicationMode bool              `yaml:"spa_mode"`
@@ -92,34 +132,23 @@ type SiteConfiguration struct {
 				CookieName string `yaml:"name"`
 			} `yaml:"cookie_tracker"`
 		} `yaml:"push"`
-		EnableCaching bool `yaml:"caching"`
+		EnableCaching bool          `yaml:"caching"`
+		Timeout       time.Duration `yaml:"timeout"`
 	} `yaml:"content"`
 	Listeners []SiteListener `yaml:"listeners"`
 	OpenAPI   struct {
-		Path   string `yaml:"path"`
-		UIPath string `yaml:"ui"`
+		Path    string        `yaml:"path"`
+		UIPath  string        `yaml:"ui"`
+		Refresh time.Duration `yaml:"refresh"`
 	} `yaml:"spec"`
-	CORS struct {
-		DisableAll          bool     `yaml:"disable"`
-		Hijack              bool     `yaml:"handle"`
-		Origins             []string `yaml:"origins"`
-		Methods             []string `yaml:"methods"`
-		RequestHeaders      []string `yaml:"request_headers"`
-		ResponseHeaders     []string `yaml:"response_headers"`
-		AllowAuthentication bool     `yaml:"authentication"`
-	} `yaml:"cors"`
+	CORS  CORSConfiguration `yaml:"cors"`
 	Retry struct {
 		Count   int           `yaml:"count"`
 		Delay   time.Duration `yaml:"delay"`
 		Timeout time.Duration `yaml:"timeout"`
 	} `yaml:"retry"`
-	Services []struct {
-		Path           string        `yaml:"path"`
-		Address        Address       `yaml:"address"`
-		OpenAPI        string        `yaml:"spec"`
-		ConnectTimeout time.Duration `yaml:"timeout_connect"`
-		ReadTimeout    time.Duration `yaml:"timeout_read"`
-	} `yaml:"services"`
+	Breaker   BreakerConfiguration   `yaml:"breaker"`
+	Services  []ServiceConfiguration `yaml:"services"`
 	Discovery struct {
 		Mode   string `yaml:"mode"`
 		Consul struct {
@@ -135,10 +164,94 @@ type SiteConfiguration struct {
 	} `yaml:"discovery"`
 }
 
+// CORSConfiguration defines the cross origin resource sharing policy
+type CORSConfiguration struct {
+	DisableAll          bool     `yaml:"disable"`
+	Hijack              bool     `yaml:"handle"`
+	Origins             []string `yaml:"origins"`
+	Methods             []string `yaml:"methods"`
+	RequestHeaders      []string `yaml:"request_headers"`
+	ResponseHeaders     []string `yaml:"response_headers"`
+	AllowAuthentication bool     `yaml:"authentication"`
+}
+
+// CORSOverride defines the parts of the site cors policy replaced by a service, anything not set is inherited
+type CORSOverride struct {
+	DisableAll          *bool    `yaml:"disable"`
+	Hijack              *bool    `yaml:"handle"`
+	Origins             []string `yaml:"origins"`
+	Methods             []string `yaml:"methods"`
+	RequestHeaders      []string `yaml:"request_headers"`
+	ResponseHeaders     []string `yaml:"response_headers"`
+	AllowAuthentication *bool    `yaml:"authentication"`
+}
+
+// Merge returns the cors configuration with the override applied
+func (c CORSConfiguration) Merge(override *CORSOverride) CORSConfiguration {
+	if override == nil {
+		return c
+	}
+
+	if override.DisableAll != nil {
+		c.DisableAll = *override.DisableAll
+	}
+
+	if override.Hijack != nil {
+		c.Hijack = *override.Hijack
+	}
+
+	if override.Origins != nil {
+		c.Origins = override.Origins
+	}
+
+	if override.Methods != nil {
+		c.Methods = override.Methods
+	}
+
+	if override.RequestHeaders != nil {
+		c.RequestHeaders = override.RequestHeaders
+	}
+
+	if override.ResponseHeaders != nil {
+		c.ResponseHeaders = override.ResponseHeaders
+	}
+
+	if override.AllowAuthentication != nil {
+		c.AllowAuthentication = *override.AllowAuthentication
+	}
+
+	return c
+}
+
+// ServiceConfiguration defines a single backend service
+type ServiceConfiguration struct {
+	Path           string        `yaml:"path"`
+	Address        Address       `yaml:"address"`
+	OpenAPI        string        `yaml:"spec"`
+	Validation     string        `yaml:"validate"`
+	ConnectTimeout time.Duration `yaml:"timeout_connect"`
+	ReadTimeout    time.Duration `yaml:"timeout_read"`
+	IdleTimeout    time.Duration `yaml:"timeout_idle"`
+	CORS           *CORSOverride `yaml:"cors"`
+}
+
+// BreakerConfiguration defines when a backend service circuit breaker will trip
+type BreakerConfiguration struct {
+	Ratio    float64       `yaml:"ratio"`
+	Minimum  int           `yaml:"minimum"`
+	Window   time.Duration `yaml:"window"`
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// SiteListener defines a single address the site is served on
 type SiteListener struct {
-	Address         Address `yaml:"address"`
-	Force           bool    `yaml:"force"`
-	StrictTransport struct {
+	Address           Address       `yaml:"address"`
+	Force             bool          `yaml:"force"`
+	ReadHeaderTimeout time.Duration `yaml:"timeout_read_header"`
+	ReadTimeout       time.Duration `yaml:"timeout_read"`
+	WriteTimeout      time.Duration `yaml:"timeout_write"`
+	IdleTimeout       time.Duration `yaml:"timeout_idle"`
+	StrictTransport   struct {
 		Age               time.Duration `yaml:"age"`
 		IncludeSubdomains bool          `yaml:"sub_domains"`
 		Preload           bool          `yaml:"preload"`
@@ -152,9 +265,11 @@ type Configuration struct {
 		HTTP    HTTPMonitorConfiguration `yaml:"http"`
 		Logging LoggingConfiguration     `yaml:"logging"`
 		Metrics MetricsConfiguration     `yaml:"metrics"`
+		Tracing TracingConfiguration     `yaml:"tracing"`
 	} `yaml:"monitoring"`
 	DNS struct {
-		Address Address `yaml:"address"`
+		Address Address  `yaml:"address"`
+		Domains []string `yaml:"domains"`
 	} `yaml:"dns"`
 	Site SiteConfiguration `yaml:"site"`
 }
@@ -169,7 +284,103 @@ func (c *Configuration) YAML() string {
 	return string(data)
 }
 
+// redacted replaces a secret setting that is set
+const redacted = "[redacted]"
+
+// Redacted returns a copy of the configuration with the secrets replaced, so it can be shown
+//
+// The consul token, TLS key paths, appended header values, and passwords in addresses are replaced.
+func (c *Configuration) Redacted() *Configuration {
+	r := *c
+
+	secret := func(value string) string {
+		if value == "" {
+			return value
+		}
+		return redacted
+	}
+
+	tls := func(t *TLSConfiguration) *TLSConfiguration {
+		if t == nil {
+			return nil
+		}
+		copied := *t
+		copied.KeyPath = secret(copied.KeyPath)
+		return &copied
+	}
+
+	r.Monitoring.HTTP.Address = r.Monitoring.HTTP.Address.Redacted()
+	r.Monitoring.HTTP.TLS = tls(r.Monitoring.HTTP.TLS)
+	r.Monitoring.Logging.Outputs.Syslog.Address = r.Monitoring.Logging.Outputs.Syslog.Address.Redacted()
+	r.Monitoring.Metrics.Address = r.Monitoring.Metrics.Address.Redacted()
+	r.Monitoring.Tracing.Address = r.Monitoring.Tracing.Address.Redacted()
+	r.DNS.Address = r.DNS.Address.Redacted()
+
+	if appended := c.Site.Headers.ExtraHeaders; appended != nil {
+		r.Site.Headers.ExtraHeaders = make(map[string]string, len(appended))
+		for name, value := range appended {
+			r.Site.Headers.ExtraHeaders[name] = secret(value)
+		}
+	}
+
+	r.Site.Listeners = make([]SiteListener, len(c.Site.Listeners))
+	for i, listener := range c.Site.Listeners {
+		listener.Address = listener.Address.Redacted()
+		listener.TLS = tls(listener.TLS)
+		r.Site.Listeners[i] = listener
+	}
+
+	r.Site.Services = make([]ServiceConfiguration, len(c.Site.Services))
+	for i, service := range c.Site.Services {
+		service.Address = service.Address.Redacted()
+		r.Site.Services[i] = service
+	}
+
+	r.Site.Discovery.Consul.Address = r.Site.Discovery.Consul.Address.Redacted()
+	r.Site.Discovery.Consul.Token = secret(r.Site.Discovery.Consul.Token)
+	r.Site.Discovery.Docker.Address = r.Site.Discovery.Docker.Address.Redacted()
+	r.Site.Discovery.Docker.KeyPath = secret(r.Site.Discovery.Docker.KeyPath)
+
+	return &r
+}
+
+// JSON outputs the configuration in JSON format, using the same names as the YAML format
+func (c *Configuration) JSON() ([]byte, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonValue(v))
+}
+
+// jsonValue converts the YAML maps (which allow any key) to maps that can be written as JSON
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonValue(value)
+		}
+		return v
+	}
+
+	return v
+}
+
 // LoadConfiguration Loads the configuration from the given reader
+//
+// Unknown keys are errors, and the configuration is validated once loaded. Every problem found is returned at once as Errors.
 func LoadConfiguration(r io.Reader) (*Configuration, error) {
 	config := DefaultConfiguration()
 
@@ -178,8 +389,25 @@ func LoadConfiguration(r io.Reader) (*Configuration, error) {
 		return nil, fmt.Errorf("failed to read configuration from reader: %v", err)
 	}
 
-	if err := yaml.Unmarshal(readerContents, config); err != nil {
-		return nil, fmt.Errorf("failed to parse configuration file: %v", err)
+	var errs Errors
+	if err := yaml.UnmarshalStrict(readerContents, config); err != nil {
+		// type errors (including unknown keys) don't stop decoding, so the rest of the configuration can still be validated
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse configuration file: %v", err)
+		}
+
+		for _, message := range typeErr.Errors {
+			errs = append(errs, decodeError(message))
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
 	return config, nil
@@ -196,9 +424,10 @@ func DefaultConfiguration() *Configuration {
 	config.Monitoring.HTTP.Address = "tcp://127.0.0.1:8080"
 
 	config.Monitoring.Logging.ParseRealIP = true
-	config.Monitoring.Logging.Outputs.Stdout.Format = "combined"
-	config.Monitoring.Logging.Outputs.Systemd.Format = "combined"
-	config.Monitoring.Logging.Outputs.Syslog.Format = "combined"
+	config.Monitoring.Logging.Level = "info"
+	config.Monitoring.Logging.Outputs.Stdout.Format = "combined-id"
+	config.Monitoring.Logging.Outputs.Systemd.Format = "combined-id"
+	config.Monitoring.Logging.Outputs.Syslog.Format = "combined-id"
 	config.Monitoring.Logging.Outputs.Syslog.Facility = "local7"
 	config.Monitoring.Logging.Outputs.Syslog.RFC = "rfc5424"
 
@@ -208,6 +437,10 @@ func DefaultConfiguration() *Configuration {
 	config.Monitoring.Metrics.Includes.Path = true
 	config.Monitoring.Metrics.Includes.Method = true
 
+	config.Monitoring.Tracing.ServiceName = "gateway"
+
+	config.DNS.Domains = []string{"consul"}
+
 	config.Site.Headers.IncludeServer = true
 	config.Site.Headers.IncludeRequestID = true
 	config.Site.Headers.IncludeDebug = false
@@ -224,6 +457,11 @@ func DefaultConfiguration() *Configuration {
 	config.Site.Retry.Delay = time.Millisecond * 10
 	config.Site.Retry.Timeout = time.Minute * 1
 
+	config.Site.Breaker.Ratio = 0.5
+	config.Site.Breaker.Minimum = 20
+	config.Site.Breaker.Window = time.Second * 10
+	config.Site.Breaker.Cooldown = time.Second * 30
+
 	config.Site.Discovery.Mode = "consul"
 	config.Site.Discovery.Consul.Address = "tcp://localhost:8500"
 
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tagPrefix = "gateway-"
+
+// ApplyTags applies discovery tags (gateway-<name>:<value>) to the service configuration
+//
+// Tags that describe the backend address (upstream, proto, tls-noverify) are used by discovery itself and are ignored here.
+func (s *ServiceConfiguration) ApplyTags(tags []string) error {
+	var errs []string
+
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, tagPrefix) {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(tag, tagPrefix), ":", 2)
+		name := parts[0]
+		value := ""
+		if len(parts) == 2 {
+			value = parts[1]
+		}
+
+		if err := s.applyTag(name, value); err != nil {
+			errs = append(errs, fmt.Sprintf("tag %q: %v", tag, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid service tags: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (s *ServiceConfiguration) applyTag(name, value string) error {
+	var err error
+
+	switch name {
+	case "path":
+		s.Path = value
+	case "spec":
+		s.OpenAPI = value
+	case "validate":
+		s.Validation = value
+	case "connect-timeout":
+		s.ConnectTimeout, err = time.ParseDuration(value)
+	case "timeout-read":
+		s.ReadTimeout, err = time.ParseDuration(value)
+	case "timeout-idle":
+		s.IdleTimeout, err = time.ParseDuration(value)
+	default:
+		if strings.HasPrefix(name, "cors-") {
+			if s.CORS == nil {
+				s.CORS = &CORSOverride{}
+			}
+			return s.CORS.applyTag(strings.TrimPrefix(name, "cors-"), value)
+		}
+	}
+
+	return err
+}
+
+func (c *CORSOverride) applyTag(name, value string) error {
+	switch name {
+	case "disable":
+		return parseBoolTag(value, &c.DisableAll)
+	case "handle":
+		return parseBoolTag(value, &c.Hijack)
+	case "authentication":
+		return parseBoolTag(value, &c.AllowAuthentication)
+	case "origins":
+		c.Origins = splitTagList(value)
+	case "methods":
+		c.Methods = splitTagList(value)
+	case "request-headers":
+		c.RequestHeaders = splitTagList(value)
+	case "response-headers":
+		c.ResponseHeaders = splitTagList(value)
+	default:
+		return fmt.Errorf("unknown cors setting %q", name)
+	}
+
+	return nil
+}
+
+func parseBoolTag(value string, into **bool) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+
+	*into = &b
+	return nil
+}
+
+func splitTagList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyTags(t *testing.T) {
+	service := ServiceConfiguration{}
+
+	err := service.ApplyTags([]string{
+		"http",
+		"gateway-path:/api/admin",
+		"gateway-upstream:/api",
+		"gateway-timeout-read:30s",
+		"gateway-validate:report-only",
+		"gateway-cors-origins:https://example.org, https://admin.example.org",
+		"gateway-cors-authentication:true",
+	})
+	if err != nil {
+		t.Fatalf("failed to apply tags: %v", err)
+	}
+
+	if service.Path != "/api/admin" || service.ReadTimeout != time.Second*30 || service.Validation != "report-only" {
+		t.Errorf("unexpected service configuration: %+v", service)
+	}
+
+	site := CORSConfiguration{Origins: []string{"*"}, Methods: []string{"GET"}}
+	merged := site.Merge(service.CORS)
+
+	if !reflect.DeepEqual(merged.Origins, []string{"https://example.org", "https://admin.example.org"}) {
+		t.Errorf("expected origins to be overridden, got %v", merged.Origins)
+	}
+
+	if !reflect.DeepEqual(merged.Methods, []string{"GET"}) {
+		t.Errorf("expected methods to be inherited, got %v", merged.Methods)
+	}
+
+	if !merged.AllowAuthentication {
+		t.Errorf("expected authentication to be overridden")
+	}
+}
+
+func TestApplyTagsInvalid(t *testing.T) {
+	service := ServiceConfiguration{}
+
+	if err := service.ApplyTags([]string{"gateway-cors-authentication:maybe", "gateway-cors-colour:blue"}); err == nil {
+		t.Errorf("expected invalid tags to return an error")
+	}
+}
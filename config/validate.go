@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+	"github.com/renevo/gateway/logging/syslog"
+	"github.com/renevo/gateway/metrics"
+	"github.com/renevo/gateway/server/openapi"
+)
+
+// Errors are all the problems found loading a configuration
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// unknownKey matches the error of a strict YAML decode for a key that isn't part of the configuration
+var unknownKey = regexp.MustCompile(`^line (\d+): field (.+) not found in (?:struct|type) `)
+
+// decodeError rewrites a YAML decoding error, naming unknown keys without the Go type they were decoded into
+func decodeError(message string) error {
+	if m := unknownKey.FindStringSubmatch(message); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return fmt.Errorf("line %d: unknown key %q", line, m[2])
+	}
+
+	return fmt.Errorf("%s", message)
+}
+
+// Validate checks the configuration before anything is started, returning every problem found as Errors
+//
+// Addresses must use a scheme supported where they are used, TLS certificates and keys must be readable, service paths must be
+// unique, and named formats, levels and modes must be supported.
+func (c *Configuration) Validate() error {
+	var errs Errors
+	fail := func(key string, f string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(f, args...)))
+	}
+
+	address := func(key string, a Address, schemes ...string) {
+		u, err := a.URL()
+		if err != nil {
+			fail(key, "invalid address %q: %v", a, err)
+			return
+		}
+
+		var expected []string
+		for _, scheme := range schemes {
+			if u.Scheme == scheme {
+				return
+			}
+			if scheme != "" {
+				expected = append(expected, scheme)
+			}
+		}
+		fail(key, "unsupported scheme %q in %q, expected %s", u.Scheme, a, strings.Join(expected, ", "))
+	}
+
+	readable := func(key, path string) {
+		f, err := os.Open(path)
+		if err != nil {
+			fail(key, "%v", err)
+			return
+		}
+		f.Close()
+	}
+
+	tls := func(key string, t *TLSConfiguration) {
+		if t == nil {
+			return
+		}
+		readable(key+".cert", t.CertificatePath)
+		readable(key+".key", t.KeyPath)
+	}
+
+	format := func(key, name string) {
+		if _, err := access.New(name); err != nil {
+			fail(key, "%v", err)
+		}
+	}
+
+	// an empty scheme is accepted where the default network is used
+	monitoring := c.Monitoring
+	if monitoring.HTTP.Enabled {
+		address("monitoring.http.address", monitoring.HTTP.Address, "", "tcp", "tcp4", "tcp6")
+		tls("monitoring.http.tls", monitoring.HTTP.TLS)
+	}
+
+	logs := monitoring.Logging
+	if logs.Level != "" {
+		if _, err := logging.ParseLevel(logs.Level); err != nil {
+			fail("monitoring.logging.level", "%v", err)
+		}
+	}
+
+	format("monitoring.logging.outputs.std.format", logs.Outputs.Stdout.Format)
+	format("monitoring.logging.outputs.systemd.format", logs.Outputs.Systemd.Format)
+
+	if syslogConfig := logs.Outputs.Syslog; syslogConfig.Address != "" {
+		address("monitoring.logging.outputs.syslog.address", syslogConfig.Address, "udp", "tcp", "unix")
+		format("monitoring.logging.outputs.syslog.format", syslogConfig.Format)
+
+		if !syslog.ValidFacility(syslogConfig.Facility) {
+			fail("monitoring.logging.outputs.syslog.facility", "unknown syslog facility %q", syslogConfig.Facility)
+		}
+
+		if !syslog.ValidRFC(syslogConfig.RFC) {
+			fail("monitoring.logging.outputs.syslog.rfc", "unknown syslog rfc %q, expected rfc3164, rfc5424 or rfc5424micro", syslogConfig.RFC)
+		}
+	}
+
+	if logs.Outputs.File.Path != "" {
+		format("monitoring.logging.outputs.file.format", logs.Outputs.File.Format)
+	}
+
+	if monitoring.Metrics.Address != "" {
+		address("monitoring.metrics.address", monitoring.Metrics.Address, "udp")
+	}
+
+	if !metrics.ValidFormat(monitoring.Metrics.Format) {
+		fail("monitoring.metrics.format", "unknown metrics format %q, expected statsd, dogstatsd, influxdb or statsite", monitoring.Metrics.Format)
+	}
+
+	if monitoring.Tracing.Address != "" {
+		address("monitoring.tracing.address", monitoring.Tracing.Address, "http", "https")
+	}
+
+	if c.DNS.Address != "" {
+		address("dns.address", c.DNS.Address, "", "udp", "tcp")
+	}
+
+	site := c.Site
+	for i, listener := range site.Listeners {
+		key := fmt.Sprintf("site.listeners[%d]", i)
+		address(key+".address", listener.Address, "", "tcp", "tcp4", "tcp6")
+		tls(key+".tls", listener.TLS)
+	}
+
+	paths := make(map[string]int)
+	for i, service := range site.Services {
+		key := fmt.Sprintf("site.services[%d]", i)
+		address(key+".address", service.Address, "http", "https")
+
+		path := service.Path
+		if path != "/" {
+			path = strings.TrimSuffix(path, "/")
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			fail(key+".path", "path %q must start with /", service.Path)
+		} else if prior, ok := paths[path]; ok {
+			fail(key+".path", "path %q is already used by site.services[%d]", service.Path, prior)
+		} else {
+			paths[path] = i
+		}
+
+		mode, err := openapi.ParseMode(service.Validation)
+		if err != nil {
+			fail(key+".validate", "%v", err)
+		} else if mode != openapi.Off && service.OpenAPI == "" {
+			fail(key+".validate", "requests can't be validated without a spec")
+		}
+	}
+
+	switch discovery := site.Discovery; discovery.Mode {
+	case "":
+	case "consul":
+		address("site.discovery.consul.address", discovery.Consul.Address, "tcp", "http", "https")
+	case "docker":
+		address("site.discovery.docker.address", discovery.Docker.Address, "unix", "tcp")
+		for _, file := range []struct{ key, path string }{
+			{"cert", discovery.Docker.CertificatePath},
+			{"key", discovery.Docker.KeyPath},
+			{"ca", discovery.Docker.CAPath},
+		} {
+			if file.path != "" {
+				readable("site.discovery.docker."+file.key, file.path)
+			}
+		}
+	default:
+		fail("site.discovery.mode", "unsupported discovery mode %q, expected consul or docker", discovery.Mode)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
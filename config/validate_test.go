@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigurationReportsEveryProblem(t *testing.T) {
+	_, err := LoadConfiguration(strings.NewReader(`
+monitoring:
+  logging:
+    level: verbose
+  metrics:
+    format: graphite
+site:
+  listeners:
+    - address: http://localhost:80
+      htsts:
+        age: 1h
+      tls:
+        cert: ./missing.crt
+        key: ./missing.key
+  services:
+    - path: /api
+      address: tcp://api:8000
+    - path: /api/
+      address: http://api:8000
+      validate: strict
+  content:
+    push:
+      cookie_tracker:
+        enable: true
+`))
+
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected configuration errors, got %v", err)
+	}
+
+	expected := []string{
+		`line 10: unknown key "htsts"`,
+		`line 24: unknown key "enable"`,
+		`monitoring.logging.level: unknown log level "verbose"`,
+		`monitoring.metrics.format: unknown metrics format "graphite", expected statsd, dogstatsd, influxdb or statsite`,
+		`site.listeners[0].address: unsupported scheme "http" in "http://localhost:80", expected tcp, tcp4, tcp6`,
+		`site.listeners[0].tls.cert: open ./missing.crt: no such file or directory`,
+		`site.listeners[0].tls.key: open ./missing.key: no such file or directory`,
+		`site.services[0].address: unsupported scheme "tcp" in "tcp://api:8000", expected http, https`,
+		`site.services[1].path: path "/api/" is already used by site.services[0]`,
+		`site.services[1].validate: unknown validation mode "strict", expected enforce or report-only`,
+	}
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestSampleConfigurationHasNoUnknownKeys(t *testing.T) {
+	f, err := os.Open("../sample.yml")
+	if err != nil {
+		t.Fatalf("failed to open the sample configuration: %v", err)
+	}
+	defer f.Close()
+
+	_, err = LoadConfiguration(f)
+	errs, _ := err.(Errors)
+	if err != nil && errs == nil {
+		t.Fatalf("failed to load the sample configuration: %v", err)
+	}
+
+	// the sample certificates aren't part of the repository
+	for _, e := range errs {
+		if !strings.Contains(e.Error(), ".tls.") {
+			t.Errorf("unexpected problem with the sample configuration: %v", e)
+		}
+	}
+}
+
+func TestDefaultConfigurationIsValid(t *testing.T) {
+	if err := DefaultConfiguration().Validate(); err != nil {
+		t.Errorf("expected the default configuration to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// record types supported by the resolver
+const (
+	typeA    uint16 = 1
+	typeAAAA uint16 = 28
+	typeSRV  uint16 = 33
+
+	classINET uint16 = 1
+)
+
+const (
+	headerSize    = 12
+	flagResponse  = 1 << 15
+	flagTruncated = 1 << 9
+	flagRecursion = 1 << 8
+	rcodeMask     = 0xF
+	rcodeNXDomain = 3
+)
+
+var (
+	errMalformed = errors.New("malformed dns message")
+	errNotFound  = errors.New("no such host")
+)
+
+// record is a single answer or additional resource record
+type record struct {
+	name string
+	typ  uint16
+	ttl  uint32
+	ip   net.IP
+	srv  *net.SRV
+}
+
+// message is the parsed subset of a DNS response the resolver cares about
+type message struct {
+	id         uint16
+	truncated  bool
+	rcode      int
+	answers    []record
+	additional []record
+}
+
+// newQuery builds a single question query for name and type
+func newQuery(id uint16, name string, typ uint16) ([]byte, error) {
+	msg := make([]byte, headerSize, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], flagRecursion)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+
+	msg, err := appendName(msg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	msg = append(msg, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(msg[len(msg)-4:], typ)
+	binary.BigEndian.PutUint16(msg[len(msg)-2:], classINET)
+
+	return msg, nil
+}
+
+func appendName(msg []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return append(msg, 0), nil
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid dns name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+
+	return append(msg, 0), nil
+}
+
+// parseMessage parses a DNS response, ignoring any records of unsupported types
+func parseMessage(msg []byte) (*message, error) {
+	if len(msg) < headerSize {
+		return nil, errMalformed
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&flagResponse == 0 {
+		return nil, errMalformed
+	}
+
+	m := &message{
+		id:        binary.BigEndian.Uint16(msg[0:]),
+		truncated: flags&flagTruncated != 0,
+		rcode:     int(flags & rcodeMask),
+	}
+
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+	authorities := int(binary.BigEndian.Uint16(msg[8:]))
+	additional := int(binary.BigEndian.Uint16(msg[10:]))
+
+	offset := headerSize
+	for i := 0; i < questions; i++ {
+		_, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+
+	sections := []struct {
+		count int
+		into  *[]record
+	}{
+		{answers, &m.answers},
+		{authorities, nil},
+		{additional, &m.additional},
+	}
+
+	for _, section := range sections {
+		for i := 0; i < section.count; i++ {
+			rr, next, err := readRecord(msg, offset)
+			if err != nil {
+				return nil, err
+			}
+			offset = next
+
+			if rr != nil && section.into != nil {
+				*section.into = append(*section.into, *rr)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func readRecord(msg []byte, offset int) (*record, int, error) {
+	name, offset, err := readName(msg, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if offset+10 > len(msg) {
+		return nil, 0, errMalformed
+	}
+
+	typ := binary.BigEndian.Uint16(msg[offset:])
+	ttl := binary.BigEndian.Uint32(msg[offset+4:])
+	length := int(binary.BigEndian.Uint16(msg[offset+8:]))
+	offset += 10
+
+	end := offset + length
+	if end > len(msg) {
+		return nil, 0, errMalformed
+	}
+
+	rr := &record{name: name, typ: typ, ttl: ttl}
+
+	switch typ {
+	case typeA:
+		if length != net.IPv4len {
+			return nil, 0, errMalformed
+		}
+		rr.ip = net.IP(append([]byte(nil), msg[offset:end]...))
+
+	case typeAAAA:
+		if length != net.IPv6len {
+			return nil, 0, errMalformed
+		}
+		rr.ip = net.IP(append([]byte(nil), msg[offset:end]...))
+
+	case typeSRV:
+		if length < 7 {
+			return nil, 0, errMalformed
+		}
+		target, _, err := readName(msg, offset+6)
+		if err != nil {
+			return nil, 0, err
+		}
+		rr.srv = &net.SRV{
+			Priority: binary.BigEndian.Uint16(msg[offset:]),
+			Weight:   binary.BigEndian.Uint16(msg[offset+2:]),
+			Port:     binary.BigEndian.Uint16(msg[offset+4:]),
+			Target:   target,
+		}
+
+	default:
+		return nil, end, nil
+	}
+
+	return rr, end, nil
+}
+
+// readName reads a possibly compressed name, returning it fully qualified and the offset after it
+func readName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errMalformed
+		}
+
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+
+		case length&0xC0 == 0xC0:
+			if offset+1 >= len(msg) {
+				return "", 0, errMalformed
+			}
+			if jumps++; jumps > 10 {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3FFF)
+
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+)
+
+const (
+	defaultTimeout = time.Second * 2
+	maxUDPSize     = 4096
+)
+
+// Resolver resolves names in the configured domains against a custom DNS server (e.g. consul)
+//
+// Any other name is resolved by the system resolver. Answers are cached for the TTL returned by the server, which
+// net.Resolver doesn't expose, so the queries to the custom server are made with a small DNS client of its own.
+type Resolver struct {
+	network  string
+	address  string
+	domains  []string
+	timeout  time.Duration
+	fallback *net.Resolver
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[cacheKey]cacheEntry
+}
+
+type cacheKey struct {
+	name string
+	typ  uint16
+}
+
+type cacheEntry struct {
+	records    []record
+	additional []record
+	expires    time.Time
+}
+
+// New creates a resolver that sends queries for the domains to addr
+//
+// The address scheme selects the transport (udp or tcp), when no port is supplied port 53 is used.
+func New(addr *url.URL, domains []string) (*Resolver, error) {
+	network := addr.Scheme
+	switch network {
+	case "":
+		network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("unsupported dns network %q", addr.Scheme)
+	}
+
+	port := addr.Port()
+	if port == "" {
+		port = "53"
+	}
+
+	r := &Resolver{
+		network:  network,
+		address:  net.JoinHostPort(addr.Hostname(), port),
+		timeout:  defaultTimeout,
+		fallback: net.DefaultResolver,
+		now:      time.Now,
+		cache:    make(map[cacheKey]cacheEntry),
+	}
+
+	for _, domain := range domains {
+		r.domains = append(r.domains, "."+strings.Trim(strings.ToLower(domain), "."))
+	}
+
+	return r, nil
+}
+
+// Handles returns true when the name will be resolved by the custom DNS server
+func (r *Resolver) Handles(name string) bool {
+	name = "." + strings.TrimSuffix(strings.ToLower(name), ".")
+	for _, domain := range r.domains {
+		if domain == "." || strings.HasSuffix(name, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LookupIP returns the IP addresses of the host
+func (r *Resolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if !r.Handles(host) {
+		addrs, err := r.fallback.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		ips := make([]net.IP, 0, len(addrs))
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+		return ips, nil
+	}
+
+	var ips []net.IP
+	for _, typ := range []uint16{typeA, typeAAAA} {
+		records, _, err := r.query(ctx, host, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rr := range records {
+			ips = append(ips, rr.ip)
+		}
+
+		if len(ips) > 0 {
+			return ips, nil
+		}
+	}
+
+	return nil, &net.DNSError{Err: errNotFound.Error(), Name: host, Server: r.address, IsNotFound: true}
+}
+
+// LookupSRV returns the SRV records for the name, sorted by priority and randomized by weight
+func (r *Resolver) LookupSRV(ctx context.Context, name string) ([]*net.SRV, error) {
+	if !r.Handles(name) {
+		_, srvs, err := r.fallback.LookupSRV(ctx, "", "", name)
+		return srvs, err
+	}
+
+	records, additional, err := r.query(ctx, name, typeSRV)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, &net.DNSError{Err: errNotFound.Error(), Name: name, Server: r.address, IsNotFound: true}
+	}
+
+	// the targets are almost always in the additional section, so remember them to save a round trip when dialing
+	r.remember(additional)
+
+	srvs := make([]*net.SRV, 0, len(records))
+	for _, rr := range records {
+		srv := *rr.srv
+		srvs = append(srvs, &srv)
+	}
+
+	sortSRV(srvs)
+	return srvs, nil
+}
+
+// DialContext connects to the address, resolving the host with the resolver
+//
+// When srv is true, the host is looked up as an SRV record to find the target and port to connect to.
+func (r *Resolver) DialContext(dialer *net.Dialer, srv bool) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		if net.ParseIP(host) != nil || !r.Handles(host) {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		type target struct {
+			host string
+			port string
+		}
+		targets := []target{{host, port}}
+
+		if srv {
+			srvs, err := r.LookupSRV(ctx, host)
+			if dnsErr, ok := err.(*net.DNSError); err != nil && (!ok || !dnsErr.IsNotFound) {
+				return nil, err
+			}
+
+			// without SRV records the host is dialed on the requested port
+			if len(srvs) > 0 {
+				targets = targets[:0]
+			}
+			for _, s := range srvs {
+				targets = append(targets, target{s.Target, strconv.Itoa(int(s.Port))})
+			}
+		}
+
+		var lastErr error
+		for _, t := range targets {
+			ips, err := r.lookupTraced(ctx, t.host)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			for _, ip := range ips {
+				conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), t.port))
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+		}
+
+		return nil, lastErr
+	}
+}
+
+// lookupTraced looks up the host, reporting the lookup to the client trace of the context (as the system resolver does)
+func (r *Resolver) lookupTraced(ctx context.Context, host string) ([]net.IP, error) {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+
+	ips, err := r.LookupIP(ctx, host)
+
+	if trace != nil && trace.DNSDone != nil {
+		addrs := make([]net.IPAddr, 0, len(ips))
+		for _, ip := range ips {
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+		trace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+	}
+
+	return ips, err
+}
+
+func (r *Resolver) query(ctx context.Context, name string, typ uint16) ([]record, []record, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+	key := cacheKey{name, typ}
+
+	r.mu.Lock()
+	entry, found := r.cache[key]
+	r.mu.Unlock()
+
+	if found && r.now().Before(entry.expires) {
+		return entry.records, entry.additional, nil
+	}
+
+	msg, err := r.exchange(ctx, name, typ)
+	if err != nil {
+		return nil, nil, &net.DNSError{Err: err.Error(), Name: name, Server: r.address}
+	}
+
+	if msg.rcode == rcodeNXDomain {
+		return nil, nil, &net.DNSError{Err: errNotFound.Error(), Name: name, Server: r.address, IsNotFound: true}
+	}
+
+	if msg.rcode != 0 {
+		return nil, nil, &net.DNSError{Err: fmt.Sprintf("server failure (rcode %d)", msg.rcode), Name: name, Server: r.address}
+	}
+
+	var records []record
+	for _, rr := range msg.answers {
+		if rr.typ == typ {
+			records = append(records, rr)
+		}
+	}
+
+	r.store(key, records, msg.additional)
+
+	return records, msg.additional, nil
+}
+
+// remember caches the address records from an additional section
+func (r *Resolver) remember(additional []record) {
+	grouped := make(map[cacheKey][]record)
+	for _, rr := range additional {
+		if rr.typ == typeA || rr.typ == typeAAAA {
+			key := cacheKey{strings.ToLower(rr.name), rr.typ}
+			grouped[key] = append(grouped[key], rr)
+		}
+	}
+
+	for key, records := range grouped {
+		r.store(key, records, nil)
+	}
+}
+
+func (r *Resolver) store(key cacheKey, records, additional []record) {
+	if len(records) == 0 {
+		return
+	}
+
+	ttl := records[0].ttl
+	for _, rr := range records {
+		if rr.ttl < ttl {
+			ttl = rr.ttl
+		}
+	}
+
+	if ttl == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	r.cache[key] = cacheEntry{
+		records:    records,
+		additional: additional,
+		expires:    r.now().Add(time.Duration(ttl) * time.Second),
+	}
+	r.mu.Unlock()
+}
+
+func (r *Resolver) exchange(ctx context.Context, name string, typ uint16) (*message, error) {
+	msg, err := r.exchangeOver(ctx, r.network, name, typ)
+	if err == nil && msg.truncated && r.network == "udp" {
+		logging.Debugf("DNS: truncated response for %s, retrying over tcp", name)
+		return r.exchangeOver(ctx, "tcp", name, typ)
+	}
+
+	return msg, err
+}
+
+func (r *Resolver) exchangeOver(ctx context.Context, network, name string, typ uint16) (*message, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query, err := newQuery(id, name, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, r.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var response []byte
+	if network == "tcp" {
+		framed := make([]byte, 2, len(query)+2)
+		binary.BigEndian.PutUint16(framed, uint16(len(query)))
+		if _, err := conn.Write(append(framed, query...)); err != nil {
+			return nil, err
+		}
+
+		response, err = readTCP(conn)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, maxUDPSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		response = buf[:n]
+	}
+
+	msg, err := parseMessage(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.id != id {
+		return nil, fmt.Errorf("dns response id mismatch")
+	}
+
+	logging.Debugf("DNS: %s type %d returned %d answers from %s", name, typ, len(msg.answers), r.address)
+
+	return msg, nil
+}
+
+func readTCP(conn net.Conn) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// sortSRV orders the records by priority, shuffling records of equal priority weighted by their weight (RFC 2782)
+func sortSRV(srvs []*net.SRV) {
+	sort.SliceStable(srvs, func(i, j int) bool {
+		return srvs[i].Priority < srvs[j].Priority
+	})
+
+	for start := 0; start < len(srvs); {
+		end := start + 1
+		for end < len(srvs) && srvs[end].Priority == srvs[start].Priority {
+			end++
+		}
+
+		group := srvs[start:end]
+		for i := range group {
+			total := 0
+			for _, s := range group[i:] {
+				total += int(s.Weight)
+			}
+			if total == 0 {
+				break
+			}
+
+			pick := rand.Intn(total)
+			for j, s := range group[i:] {
+				pick -= int(s.Weight)
+				if pick < 0 {
+					group[i], group[i+j] = group[i+j], group[i]
+					break
+				}
+			}
+		}
+
+		start = end
+	}
+}
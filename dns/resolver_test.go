@@ -0,0 +1,227 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubServer is an in-process DNS server answering from a fixed set of records
+type stubServer struct {
+	conn    net.PacketConn
+	records map[string][]stubRecord
+	queries int32
+}
+
+type stubRecord struct {
+	typ   uint16
+	ttl   uint32
+	rdata []byte
+}
+
+func newStubServer(t *testing.T, records map[string][]stubRecord) *stubServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &stubServer{conn: conn, records: records}
+	go s.serve()
+
+	return s
+}
+
+func (s *stubServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		atomic.AddInt32(&s.queries, 1)
+		s.conn.WriteTo(s.answer(buf[:n]), addr)
+	}
+}
+
+func (s *stubServer) answer(query []byte) []byte {
+	name, end, _ := readName(query, headerSize)
+	typ := binary.BigEndian.Uint16(query[end:])
+
+	var answers []stubRecord
+	for _, rr := range s.records[name] {
+		if rr.typ == typ {
+			answers = append(answers, rr)
+		}
+	}
+
+	msg := append([]byte(nil), query[:end+4]...)
+	binary.BigEndian.PutUint16(msg[2:], flagResponse|flagRecursion)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(answers)))
+
+	if _, found := s.records[name]; !found {
+		msg[3] |= rcodeNXDomain
+	}
+
+	for _, rr := range answers {
+		// compressed pointer to the question name
+		msg = append(msg, 0xC0, headerSize)
+		msg = append(msg, make([]byte, 10)...)
+		binary.BigEndian.PutUint16(msg[len(msg)-10:], rr.typ)
+		binary.BigEndian.PutUint16(msg[len(msg)-8:], classINET)
+		binary.BigEndian.PutUint32(msg[len(msg)-6:], rr.ttl)
+		binary.BigEndian.PutUint16(msg[len(msg)-2:], uint16(len(rr.rdata)))
+		msg = append(msg, rr.rdata...)
+	}
+
+	return msg
+}
+
+func srvData(priority, weight, port uint16, target string) []byte {
+	data := make([]byte, 6)
+	binary.BigEndian.PutUint16(data[0:], priority)
+	binary.BigEndian.PutUint16(data[2:], weight)
+	binary.BigEndian.PutUint16(data[4:], port)
+	data, _ = appendName(data, target)
+	return data
+}
+
+func newTestResolver(t *testing.T, s *stubServer) *Resolver {
+	addr, _ := url.Parse("udp://" + s.conn.LocalAddr().String())
+	r, err := New(addr, []string{"consul"})
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+	return r
+}
+
+func TestLookupIPCachesByTTL(t *testing.T) {
+	s := newStubServer(t, map[string][]stubRecord{
+		"test.service.consul.": {{typ: typeA, ttl: 30, rdata: []byte{127, 0, 0, 1}}},
+	})
+	defer s.conn.Close()
+
+	now := time.Now()
+	r := newTestResolver(t, s)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ips, err := r.LookupIP(context.Background(), "test.service.consul")
+		if err != nil {
+			t.Fatalf("lookup failed: %v", err)
+		}
+
+		if len(ips) != 1 || !ips[0].Equal(net.IPv4(127, 0, 0, 1)) {
+			t.Fatalf("unexpected ips: %v", ips)
+		}
+	}
+
+	if queries := atomic.LoadInt32(&s.queries); queries != 1 {
+		t.Errorf("expected cached answers to be reused, server saw %d queries", queries)
+	}
+
+	now = now.Add(time.Second * 31)
+	r.LookupIP(context.Background(), "test.service.consul")
+
+	if queries := atomic.LoadInt32(&s.queries); queries != 2 {
+		t.Errorf("expected expired answer to be queried again, server saw %d queries", queries)
+	}
+}
+
+func TestLookupIPNotFound(t *testing.T) {
+	s := newStubServer(t, nil)
+	defer s.conn.Close()
+
+	_, err := newTestResolver(t, s).LookupIP(context.Background(), "missing.service.consul")
+
+	dnsErr, ok := err.(*net.DNSError)
+	if !ok || !dnsErr.IsNotFound {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestDialContextUsesSRVPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+	s := newStubServer(t, map[string][]stubRecord{
+		"test.service.consul.": {{typ: typeSRV, ttl: 30, rdata: srvData(1, 1, port, "node1.node.consul.")}},
+		"node1.node.consul.":   {{typ: typeA, ttl: 30, rdata: []byte{127, 0, 0, 1}}},
+	})
+	defer s.conn.Close()
+
+	dial := newTestResolver(t, s).DialContext(&net.Dialer{}, true)
+
+	conn, err := dial(context.Background(), "tcp", "test.service.consul:80")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if conn.RemoteAddr().(*net.TCPAddr).Port != int(port) {
+		t.Errorf("expected to connect to srv port %d, connected to %s", port, conn.RemoteAddr())
+	}
+}
+
+func TestDialContextWithoutSRVUsesRequestedPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	s := newStubServer(t, map[string][]stubRecord{
+		"test.service.consul.": {{typ: typeA, ttl: 30, rdata: []byte{127, 0, 0, 1}}},
+	})
+	defer s.conn.Close()
+
+	dial := newTestResolver(t, s).DialContext(&net.Dialer{}, true)
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	conn, err := dial(context.Background(), "tcp", "test.service.consul:"+port)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	conn.Close()
+}
+
+func TestHandles(t *testing.T) {
+	addr, _ := url.Parse("tcp://localhost:8600")
+	r, _ := New(addr, []string{"consul", ".internal."})
+
+	tests := map[string]bool{
+		"test.service.consul":  true,
+		"test.service.consul.": true,
+		"db.internal":          true,
+		"example.org":          false,
+		"notconsul":            false,
+	}
+
+	for name, expected := range tests {
+		if r.Handles(name) != expected {
+			t.Errorf("Handles(%q) expected %v", name, expected)
+		}
+	}
+}
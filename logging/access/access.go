@@ -0,0 +1,256 @@
+package access
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is a single completed HTTP request
+type Entry struct {
+	// Time the request was received
+	Time time.Time
+	// RemoteAddr is the client address without the port
+	RemoteAddr string
+	// User is the authenticated user name, when known
+	User      string
+	Method    string
+	URI       string
+	Proto     string
+	Host      string
+	Status    int
+	Size      int64
+	Referer   string
+	UserAgent string
+	Duration  time.Duration
+	RequestID string
+	// Route is the mounted path that served the request, it is not part of the log formats
+	Route string
+	// Upstream is the backend service address that served the request, empty for the static site, it is not part of the log formats
+	Upstream string
+}
+
+// Formatter renders an access log line (without a trailing new line)
+type Formatter func(e *Entry) []byte
+
+// apache/nginx time format
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// New returns the formatter for the named format: common, combined, combined-id, json, json-pretty, bunyan, or logfmt
+func New(format string) (Formatter, error) {
+	switch format {
+	case "", "common":
+		return Common, nil
+	case "combined":
+		return Combined, nil
+	case "combined-id":
+		return CombinedID, nil
+	case "json":
+		return JSON, nil
+	case "json-pretty":
+		return PrettyJSON, nil
+	case "bunyan":
+		hostname, _ := os.Hostname()
+		return bunyan(hostname, os.Getpid()), nil
+	case "logfmt":
+		return Logfmt, nil
+	}
+
+	return nil, fmt.Errorf("unknown access log format %q", format)
+}
+
+// Common renders the NCSA common log format: %h %l %u %t "%r" %>s %b
+func Common(e *Entry) []byte {
+	var buf bytes.Buffer
+	common(&buf, e)
+	return buf.Bytes()
+}
+
+// Combined renders the NCSA combined log format: %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func Combined(e *Entry) []byte {
+	var buf bytes.Buffer
+	common(&buf, e)
+	buf.WriteString(` "`)
+	buf.WriteString(escape(dash(e.Referer)))
+	buf.WriteString(`" "`)
+	buf.WriteString(escape(dash(e.UserAgent)))
+	buf.WriteByte('"')
+	return buf.Bytes()
+}
+
+// CombinedID renders the combined log format followed by the request id: ... "%{User-agent}i" "%{X-Request-ID}"
+func CombinedID(e *Entry) []byte {
+	buf := bytes.NewBuffer(Combined(e))
+	buf.WriteString(` "`)
+	buf.WriteString(escape(dash(e.RequestID)))
+	buf.WriteByte('"')
+	return buf.Bytes()
+}
+
+func common(buf *bytes.Buffer, e *Entry) {
+	size := "-"
+	if e.Size > 0 {
+		size = strconv.FormatInt(e.Size, 10)
+	}
+
+	fmt.Fprintf(buf, `%s - %s [%s] "%s %s %s" %d %s`,
+		dash(e.RemoteAddr),
+		escape(dash(e.User)),
+		e.Time.Format(clfTime),
+		escape(e.Method), escape(e.URI), escape(e.Proto),
+		e.Status,
+		size,
+	)
+}
+
+// record is the JSON representation of an entry
+type record struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remote_addr"`
+	User       string  `json:"user,omitempty"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Host       string  `json:"host"`
+	Status     int     `json:"status"`
+	Size       int64   `json:"size"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	Duration   float64 `json:"duration_ms"`
+	RequestID  string  `json:"request_id,omitempty"`
+}
+
+func newRecord(e *Entry) record {
+	return record{
+		Time:       e.Time.Format(time.RFC3339Nano),
+		RemoteAddr: e.RemoteAddr,
+		User:       e.User,
+		Method:     e.Method,
+		URI:        e.URI,
+		Proto:      e.Proto,
+		Host:       e.Host,
+		Status:     e.Status,
+		Size:       e.Size,
+		Referer:    e.Referer,
+		UserAgent:  e.UserAgent,
+		Duration:   milliseconds(e.Duration),
+		RequestID:  e.RequestID,
+	}
+}
+
+// JSON renders the entry as a single line JSON object
+func JSON(e *Entry) []byte {
+	data, _ := json.Marshal(newRecord(e))
+	return data
+}
+
+// PrettyJSON renders the entry as an indented JSON object
+func PrettyJSON(e *Entry) []byte {
+	data, _ := json.MarshalIndent(newRecord(e), "", "  ")
+	return data
+}
+
+// bunyan renders the entry as a bunyan (node-bunyan) log record at level INFO
+func bunyan(hostname string, pid int) Formatter {
+	return func(e *Entry) []byte {
+		data, _ := json.Marshal(struct {
+			Version  int    `json:"v"`
+			Level    int    `json:"level"`
+			Name     string `json:"name"`
+			Hostname string `json:"hostname"`
+			PID      int    `json:"pid"`
+			Time     string `json:"time"`
+			Message  string `json:"msg"`
+			record
+		}{
+			Level:    30,
+			Name:     "gateway",
+			Hostname: hostname,
+			PID:      pid,
+			// bunyan times are always UTC with millisecond precision
+			Time:    e.Time.UTC().Format("2006-01-02T15:04:05.000Z"),
+			Message: fmt.Sprintf("%s %s %d", e.Method, e.URI, e.Status),
+			record:  newRecord(e),
+		})
+		return data
+	}
+}
+
+// Logfmt renders the entry as key=value pairs, empty values are left out
+func Logfmt(e *Entry) []byte {
+	pairs := [][2]string{
+		{"time", e.Time.Format(time.RFC3339)},
+		{"remote_addr", e.RemoteAddr},
+		{"user", e.User},
+		{"method", e.Method},
+		{"uri", e.URI},
+		{"proto", e.Proto},
+		{"host", e.Host},
+		{"status", strconv.Itoa(e.Status)},
+		{"size", strconv.FormatInt(e.Size, 10)},
+		{"referer", e.Referer},
+		{"user_agent", e.UserAgent},
+		{"duration_ms", strconv.FormatFloat(milliseconds(e.Duration), 'f', -1, 64)},
+		{"request_id", e.RequestID},
+	}
+
+	var buf bytes.Buffer
+	for _, pair := range pairs {
+		if pair[1] == "" {
+			continue
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(pair[0])
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(pair[1]))
+	}
+
+	return buf.Bytes()
+}
+
+// logfmtValue quotes values containing spaces, quotes, equal signs, or control characters
+func logfmtValue(value string) string {
+	if strings.ContainsAny(value, " =\"\\") || strings.IndexFunc(value, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0 {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// escape follows apache, quotes and backslashes are escaped along with any non printable characters as \xhh
+func escape(value string) string {
+	var buf strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&buf, `\x%02x`, c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String()
+}
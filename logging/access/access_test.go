@@ -0,0 +1,82 @@
+package access
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+var entries = []*Entry{
+	{
+		Time:       time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+		RemoteAddr: "127.0.0.1",
+		User:       "frank",
+		Method:     "GET",
+		URI:        "/apache_pb.gif",
+		Proto:      "HTTP/1.0",
+		Host:       "www.example.com",
+		Status:     200,
+		Size:       2326,
+		Referer:    "http://www.example.com/start.html",
+		UserAgent:  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+		Duration:   time.Millisecond*12 + time.Microsecond*345,
+		RequestID:  "6ba7b810-9dad-41d1-80b4-00c04fd430c8",
+	},
+	{
+		Time:       time.Date(2017, 10, 10, 8, 0, 0, 0, time.UTC),
+		RemoteAddr: "2001:db8::1",
+		Method:     "POST",
+		URI:        `/api/"quoted"?q=a\b`,
+		Proto:      "HTTP/1.1",
+		Host:       "api.example.org",
+		Status:     204,
+		UserAgent:  "curl/7.55.1\n",
+		Duration:   time.Second,
+	},
+}
+
+func TestFormats(t *testing.T) {
+	formats := map[string]Formatter{
+		"common":      Common,
+		"combined":    Combined,
+		"combined-id": CombinedID,
+		"json":        JSON,
+		"json-pretty": PrettyJSON,
+		"bunyan":      bunyan("gateway01", 4242),
+		"logfmt":      Logfmt,
+	}
+
+	for name, format := range formats {
+		var actual []byte
+		for _, e := range entries {
+			actual = append(actual, format(e)...)
+			actual = append(actual, '\n')
+		}
+
+		golden := filepath.Join("testdata", name+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+				t.Fatalf("failed to update %s: %v", golden, err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", golden, err)
+		}
+
+		if string(actual) != string(expected) {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, expected, actual)
+		}
+	}
+}
+
+func TestNewUnknown(t *testing.T) {
+	if _, err := New("xml"); err == nil {
+		t.Errorf("expected an unknown format to return an error")
+	}
+}
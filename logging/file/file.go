@@ -0,0 +1,276 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+)
+
+// queueSize is how many lines can be waiting for the disk before new lines are dropped
+const queueSize = 4096
+
+// Options defines the access log file and when it is rotated
+type Options struct {
+	// Path of the access log file
+	Path string
+	// Format renders the access log lines
+	Format access.Formatter
+	// MaxSize rotates the file before it grows past this many bytes, zero to disable
+	MaxSize int64
+	// MaxAge rotates the file once it has been written to for this long, zero to disable
+	MaxAge time.Duration
+	// Keep is how many compressed generations (<path>.1.gz is the newest) are kept
+	Keep int
+}
+
+// Writer writes the access logs to a file
+//
+// Lines are written in the background so requests never wait on the disk, when the disk can't keep up lines are dropped.
+type Writer struct {
+	options Options
+
+	lines  chan []byte
+	reopen chan struct{}
+	done   chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+
+	// owned by the write loop
+	file        *os.File
+	size        int64
+	opened      time.Time
+	compressing sync.WaitGroup
+}
+
+// New opens (or creates) the access log file
+func New(options Options) (*Writer, error) {
+	if options.Path == "" {
+		return nil, fmt.Errorf("access log file path is required")
+	}
+
+	if options.Format == nil {
+		options.Format = access.Common
+	}
+
+	w := &Writer{
+		options: options,
+		lines:   make(chan []byte, queueSize),
+		reopen:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *Writer) Access(e *access.Entry) {
+	line := append(w.options.Format(e), '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	select {
+	case w.lines <- line:
+	default:
+		w.dropped++
+	}
+}
+
+// Log ignores application log messages, only access logs are written to the file
+func (w *Writer) Log(m *logging.Message) {}
+
+// Reopen closes and reopens the file, after it was moved by an external tool (e.g. logrotate)
+func (w *Writer) Reopen() {
+	select {
+	case w.reopen <- struct{}{}:
+	default:
+	}
+}
+
+// Close writes the queued lines and closes the file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.lines)
+	dropped := w.dropped
+	w.mu.Unlock()
+
+	<-w.done
+
+	if dropped > 0 {
+		return fmt.Errorf("access log: dropped %d lines", dropped)
+	}
+
+	return nil
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	defer w.compressing.Wait()
+	defer func() {
+		if w.file != nil {
+			w.file.Close()
+		}
+	}()
+
+	for {
+		select {
+		case line, ok := <-w.lines:
+			if !ok {
+				return
+			}
+			w.write(line)
+		case <-w.reopen:
+			if w.file != nil {
+				w.file.Close()
+				w.file = nil
+			}
+			w.report("reopen", w.open())
+		}
+	}
+}
+
+func (w *Writer) write(line []byte) {
+	if w.file != nil && w.due(int64(len(line))) {
+		w.report("rotate", w.rotate())
+	}
+
+	if w.file == nil {
+		// the file failed to open before, try again
+		if err := w.open(); err != nil {
+			w.report("open", err)
+			return
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	w.report("write", err)
+}
+
+// due returns true when writing size more bytes requires the file to be rotated first
+func (w *Writer) due(size int64) bool {
+	if w.options.MaxSize > 0 && w.size > 0 && w.size+size > w.options.MaxSize {
+		return true
+	}
+
+	return w.options.MaxAge > 0 && time.Since(w.opened) >= w.options.MaxAge
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.options.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+	w.opened = time.Now()
+	if w.size > 0 {
+		// appending to the file of an earlier run, so its age carries over from when it was last written
+		w.opened = info.ModTime()
+	}
+	return nil
+}
+
+// rotate shifts the compressed generations, starts a new file, and compresses the current file as generation 1
+//
+// The file is compressed in the background so lines keep being written, a rotation waits for the previous compression
+// before the generations are shifted.
+func (w *Writer) rotate() error {
+	w.file.Close()
+	w.file = nil
+
+	path := w.options.Path
+	if w.options.Keep <= 0 {
+		os.Remove(path)
+		return w.open()
+	}
+
+	w.compressing.Wait()
+
+	os.Remove(generation(path, w.options.Keep))
+	for i := w.options.Keep - 1; i >= 1; i-- {
+		os.Rename(generation(path, i), generation(path, i+1))
+	}
+
+	rotated := path + ".1"
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+
+	w.compressing.Add(1)
+	go func() {
+		defer w.compressing.Done()
+		w.report("compress", compress(rotated, generation(path, 1)))
+	}()
+
+	return w.open()
+}
+
+func generation(path string, i int) string {
+	return path + "." + strconv.Itoa(i) + ".gz"
+}
+
+func compress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// report writes file errors to stderr, the logs can't be used to report a failure to write the logs
+func (w *Writer) report(action string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "access log: failed to %s %s: %v\n", action, w.options.Path, err)
+	}
+}
@@ -0,0 +1,131 @@
+package file
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+func line(text string) access.Formatter {
+	return func(e *access.Entry) []byte {
+		return []byte(text)
+	}
+}
+
+func readGzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+
+	data, _ := ioutil.ReadAll(gz)
+	return string(data)
+}
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	w, err := New(Options{Path: path, Format: line("0123456789"), MaxSize: 25, Keep: 2})
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	// 11 bytes per line, so each file holds 2 lines: 4 rotations with only the newest 2 kept
+	for i := 0; i < 9; i++ {
+		w.Access(&access.Entry{})
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	current, _ := ioutil.ReadFile(path)
+	if string(current) != "0123456789\n" {
+		t.Errorf("unexpected current file: %q", current)
+	}
+
+	for _, gen := range []string{".1.gz", ".2.gz"} {
+		if data := readGzip(t, path+gen); data != "0123456789\n0123456789\n" {
+			t.Errorf("unexpected generation %s: %q", gen, data)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3.gz"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 generations to be kept")
+	}
+}
+
+func TestRotateExistingFileByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	if err := ioutil.WriteFile(path, []byte("previous\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	// written before the gateway was restarted
+	modified := time.Now().Add(-time.Hour * 2)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("failed to age log: %v", err)
+	}
+
+	w, err := New(Options{Path: path, Format: line("request"), MaxAge: time.Hour, Keep: 1})
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+
+	w.Access(&access.Entry{})
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(path); string(data) != "request\n" {
+		t.Errorf("expected the line in a new file, got %q", data)
+	}
+
+	if data := readGzip(t, path+".1.gz"); data != "previous\n" {
+		t.Errorf("expected the previous file to be rotated, got %q", data)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	w, err := New(Options{Path: path, Format: line("request")})
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer w.Close()
+
+	// logrotate moves the file, then signals the gateway
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatalf("failed to move log: %v", err)
+	}
+	w.Reopen()
+
+	for start := time.Now(); ; time.Sleep(time.Millisecond * 10) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Since(start) > time.Second*5 {
+			t.Fatalf("expected the file to be reopened")
+		}
+	}
+
+	w.Access(&access.Entry{})
+	w.Close()
+
+	if data, _ := ioutil.ReadFile(path); string(data) != "request\n" {
+		t.Errorf("expected the line in the reopened file, got %q", data)
+	}
+}
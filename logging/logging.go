@@ -1,59 +1,221 @@
 package logging
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/renevo/gateway/env"
+	"github.com/renevo/gateway/logging/access"
+	"github.com/renevo/gateway/requestid"
 )
 
+// Level is the severity of an application log message
+type Level int
+
 const (
-	levelDebug = "DEBUG"
-	levelInfo  = "INFO"
-	levelError = "ERROR"
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
 )
 
 const (
 	envDebug = "GATEWAY_DEBUG"
 )
 
-var isDebug = false
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name (debug, info, warn, error)
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+
+	if strings.EqualFold(name, "warning") {
+		return LevelWarn, nil
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+var (
+	mu       sync.RWMutex
+	minLevel = LevelInfo
+	outputs  = []Output{NewStream(os.Stdout, os.Stderr, access.Common)}
+)
 
 func init() {
-	isDebug = env.Bool(envDebug)
+	if env.Bool(envDebug) {
+		minLevel = LevelDebug
+	}
 }
 
-func Debug(msg string) {
-	if !isDebug {
-		return
+// SetLevel sets the minimum level of the application log messages that are written
+//
+// When GATEWAY_DEBUG is set, debug messages are always written.
+func SetLevel(level Level) {
+	if env.Bool(envDebug) {
+		level = LevelDebug
 	}
-	printLevel(levelDebug, msg)
+
+	mu.Lock()
+	minLevel = level
+	mu.Unlock()
+}
+
+// SetOutputs replaces where the access and application logs are written
+func SetOutputs(o ...Output) {
+	mu.Lock()
+	outputs = o
+	mu.Unlock()
+}
+
+// Close closes the outputs, sending any logs that are still queued
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var err error
+	for _, output := range outputs {
+		if closer, ok := output.(io.Closer); ok {
+			if cerr := closer.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	outputs = nil
+
+	return err
+}
+
+func enabled(level Level) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return level >= minLevel
+}
+
+func Debug(msg string) {
+	printLevel(LevelDebug, "", msg)
 }
 
 func Debugf(f string, args ...interface{}) {
-	if !isDebug {
+	if !enabled(LevelDebug) {
 		return
 	}
-	printLevel(levelDebug, fmt.Sprintf(f, args...))
+	printLevel(LevelDebug, "", fmt.Sprintf(f, args...))
 }
 
 func Info(msg string) {
-	printLevel(levelInfo, msg)
+	printLevel(LevelInfo, "", msg)
 }
 
 func Infof(f string, args ...interface{}) {
-	printLevel(levelInfo, fmt.Sprintf(f, args...))
+	printLevel(LevelInfo, "", fmt.Sprintf(f, args...))
+}
+
+func Warn(msg string) {
+	printLevel(LevelWarn, "", msg)
+}
+
+func Warnf(f string, args ...interface{}) {
+	printLevel(LevelWarn, "", fmt.Sprintf(f, args...))
 }
 
 func Error(msg string) {
-	printLevel(levelError, msg)
+	printLevel(LevelError, "", msg)
 }
 
 func Errorf(f string, args ...interface{}) {
-	printLevel(levelError, fmt.Sprintf(f, args...))
+	printLevel(LevelError, "", fmt.Sprintf(f, args...))
+}
+
+// Access writes a completed request to the access logs
+func Access(e *access.Entry) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, output := range outputs {
+		output.Access(e)
+	}
+}
+
+func printLevel(level Level, requestID, msg string) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if level < minLevel {
+		return
+	}
+
+	m := &Message{
+		Time:      time.Now(),
+		Level:     level,
+		RequestID: requestID,
+		Text:      msg,
+	}
+
+	for _, output := range outputs {
+		output.Log(m)
+	}
+}
+
+// Logger writes application log messages while handling a single request
+type Logger struct {
+	requestID string
+}
+
+// FromContext returns a logger that includes the request id of the context in every message
+func FromContext(ctx context.Context) *Logger {
+	return &Logger{requestID: requestid.FromContext(ctx)}
+}
+
+func (l *Logger) Debug(msg string) {
+	printLevel(LevelDebug, l.requestID, msg)
+}
+
+func (l *Logger) Debugf(f string, args ...interface{}) {
+	if !enabled(LevelDebug) {
+		return
+	}
+	printLevel(LevelDebug, l.requestID, fmt.Sprintf(f, args...))
+}
+
+func (l *Logger) Info(msg string) {
+	printLevel(LevelInfo, l.requestID, msg)
+}
+
+func (l *Logger) Infof(f string, args ...interface{}) {
+	printLevel(LevelInfo, l.requestID, fmt.Sprintf(f, args...))
+}
+
+func (l *Logger) Warn(msg string) {
+	printLevel(LevelWarn, l.requestID, msg)
+}
+
+func (l *Logger) Warnf(f string, args ...interface{}) {
+	printLevel(LevelWarn, l.requestID, fmt.Sprintf(f, args...))
+}
+
+func (l *Logger) Error(msg string) {
+	printLevel(LevelError, l.requestID, msg)
 }
 
-func printLevel(level, msg string) {
-	fmt.Fprintln(os.Stdout, time.Now().Format("15:04:05")+" "+level+" "+msg)
+func (l *Logger) Errorf(f string, args ...interface{}) {
+	printLevel(LevelError, l.requestID, fmt.Sprintf(f, args...))
 }
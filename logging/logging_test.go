@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/logging/access"
+	"github.com/renevo/gateway/requestid"
+)
+
+func TestStreamsAndLevels(t *testing.T) {
+	var accessLog, appLog bytes.Buffer
+	SetOutputs(NewStream(&accessLog, &appLog, access.Common))
+	SetLevel(LevelWarn)
+	defer SetOutputs(NewStream(os.Stdout, os.Stderr, access.Common))
+	defer SetLevel(LevelInfo)
+
+	Info("hidden")
+	Warnf("disk %d%% full", 90)
+	FromContext(requestid.NewContext(context.Background(), "abc-123")).Error("failed")
+
+	Access(&access.Entry{
+		Time:       time.Date(2017, 10, 10, 8, 0, 0, 0, time.UTC),
+		RemoteAddr: "127.0.0.1",
+		Method:     "GET",
+		URI:        "/",
+		Proto:      "HTTP/1.1",
+		Status:     200,
+	})
+
+	expected := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(Z|[+-]\d{2}:\d{2}) WARN disk 90% full\n` +
+		`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(Z|[+-]\d{2}:\d{2}) ERROR \[abc-123\] failed\n$`)
+	if !expected.Match(appLog.Bytes()) {
+		t.Errorf("unexpected application log:\n%s", appLog.String())
+	}
+
+	if line := accessLog.String(); line != "127.0.0.1 - - [10/Oct/2017:08:00:00 +0000] \"GET / HTTP/1.1\" 200 -\n" {
+		t.Errorf("unexpected access log: %q", line)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("warning"); err != nil || level != LevelWarn {
+		t.Errorf("expected warning to parse as WARN, got %v: %v", level, err)
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("expected an unknown level to return an error")
+	}
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+// Message is a single application log message
+type Message struct {
+	Time      time.Time
+	Level     Level
+	RequestID string
+	Text      string
+}
+
+// Output receives the access and application logs
+type Output interface {
+	// Access writes a completed request
+	Access(e *access.Entry)
+	// Log writes an application log message
+	Log(m *Message)
+}
+
+// Stream writes access logs and application logs to separate writers
+type Stream struct {
+	mu     sync.Mutex
+	access io.Writer
+	app    io.Writer
+	format access.Formatter
+}
+
+// NewStream creates an output writing formatted access logs to accessLog and application logs to appLog
+//
+// Both may be the same writer, every line is written with a single call.
+func NewStream(accessLog, appLog io.Writer, format access.Formatter) *Stream {
+	return &Stream{
+		access: accessLog,
+		app:    appLog,
+		format: format,
+	}
+}
+
+func (s *Stream) Access(e *access.Entry) {
+	line := append(s.format(e), '\n')
+
+	s.mu.Lock()
+	s.access.Write(line)
+	s.mu.Unlock()
+}
+
+func (s *Stream) Log(m *Message) {
+	line := formatMessage(m)
+
+	s.mu.Lock()
+	s.app.Write(line)
+	s.mu.Unlock()
+}
+
+// formatMessage renders an application log line: <RFC3339 time> <LEVEL> [<request id>] <message>
+func formatMessage(m *Message) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(m.Time.Format(time.RFC3339))
+	buf.WriteByte(' ')
+	buf.WriteString(m.Level.String())
+	buf.WriteByte(' ')
+	if m.RequestID != "" {
+		buf.WriteString("[" + m.RequestID + "] ")
+	}
+	buf.WriteString(m.Text)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
@@ -0,0 +1,419 @@
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+)
+
+const (
+	// appID is the structured data id of application log messages
+	appID = "gateway@20171010"
+	// httpID is the structured data id of access log messages
+	httpID = "gatewayHTTP@20171010"
+
+	appName = "gateway"
+
+	// maxQueue is how many messages are kept while the syslog server can't be reached, the oldest are dropped first
+	maxQueue = 1024
+
+	writeTimeout = time.Second * 5
+	closeTimeout = time.Second * 5
+	minBackoff   = time.Millisecond * 100
+	maxBackoff   = time.Second * 30
+)
+
+// severities
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var timestamps = map[string]string{
+	"rfc3164":      time.Stamp,
+	"rfc5424":      time.RFC3339,
+	"rfc5424micro": "2006-01-02T15:04:05.000000Z07:00",
+}
+
+// ValidFacility returns true when the facility name is known
+func ValidFacility(name string) bool {
+	_, ok := facilities[strings.ToLower(name)]
+	return ok
+}
+
+// ValidRFC returns true when the message format is supported, empty uses rfc5424
+func ValidRFC(name string) bool {
+	_, ok := timestamps[strings.ToLower(name)]
+	return ok || name == ""
+}
+
+// StructuredData is a custom structured data element added to every message (RFC5424 only)
+type StructuredData struct {
+	ID     string
+	Params map[string]string
+}
+
+// Options defines the syslog server and message format
+type Options struct {
+	// Network is udp, tcp, or unix
+	Network string
+	// Address is the host:port, or socket path for unix
+	Address string
+	// Facility name, e.g. local7
+	Facility string
+	// RFC is the message format: rfc3164, rfc5424, or rfc5424micro
+	RFC string
+	// Format renders the access log messages
+	Format access.Formatter
+	// Data is added to every message
+	Data []StructuredData
+}
+
+// Writer sends the access and application logs to a syslog server
+//
+// Messages are queued and sent in the background, when the server can't be reached the writer will reconnect and send
+// the queued messages once it is back.
+type Writer struct {
+	network   string
+	address   string
+	facility  int
+	rfc       string
+	timestamp string
+	format    access.Formatter
+	data      string
+	hostname  string
+	pid       int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   [][]byte
+	sending []byte
+	dropped int
+	closed  bool
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// New creates the syslog writer and starts sending messages in the background
+func New(options Options) (*Writer, error) {
+	facility, ok := facilities[strings.ToLower(options.Facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", options.Facility)
+	}
+
+	rfc := strings.ToLower(options.RFC)
+	if rfc == "" {
+		rfc = "rfc5424"
+	}
+
+	timestamp, ok := timestamps[rfc]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog rfc %q", options.RFC)
+	}
+
+	switch options.Network {
+	case "udp", "tcp", "unix":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", options.Network)
+	}
+
+	var data bytes.Buffer
+	for _, element := range options.Data {
+		if !validName(element.ID) {
+			return nil, fmt.Errorf("invalid syslog structured data id %q", element.ID)
+		}
+		writeElement(&data, element.ID, sortedParams(element.Params))
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+
+	w := &Writer{
+		network:   options.Network,
+		address:   options.Address,
+		facility:  facility,
+		rfc:       rfc,
+		timestamp: timestamp,
+		format:    options.Format,
+		data:      data.String(),
+		hostname:  hostname,
+		pid:       os.Getpid(),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	if w.format == nil {
+		w.format = access.Common
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// Access sends a completed request at INFO, or ERR for server errors
+func (w *Writer) Access(e *access.Entry) {
+	severity := severityInfo
+	if e.Status >= 500 {
+		severity = severityError
+	}
+
+	w.send(e.Time, severity, httpID, [][2]string{
+		{"method", e.Method},
+		{"uri", e.URI},
+		{"status", strconv.Itoa(e.Status)},
+		{"request_id", e.RequestID},
+	}, w.format(e))
+}
+
+// Log sends an application log message at the matching severity
+func (w *Writer) Log(m *logging.Message) {
+	severity := severityInfo
+	switch m.Level {
+	case logging.LevelDebug:
+		severity = severityDebug
+	case logging.LevelWarn:
+		severity = severityWarning
+	case logging.LevelError:
+		severity = severityError
+	}
+
+	w.send(m.Time, severity, appID, [][2]string{
+		{"level", m.Level.String()},
+		{"request_id", m.RequestID},
+	}, []byte(m.Text))
+}
+
+// Close stops the writer, messages that have not been sent within a few seconds are dropped
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-time.After(closeTimeout):
+	}
+
+	close(w.closing)
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dropped := len(w.queue) + w.dropped
+	if w.sending != nil {
+		dropped++
+	}
+	if dropped > 0 {
+		return fmt.Errorf("syslog: dropped %d messages", dropped)
+	}
+
+	return nil
+}
+
+// message renders a single syslog message
+func (w *Writer) message(t time.Time, severity int, id string, params [][2]string, msg []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<" + strconv.Itoa(w.facility*8+severity) + ">")
+
+	if w.rfc == "rfc3164" {
+		// <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+		fmt.Fprintf(&buf, "%s %s %s[%d]: ", t.Format(w.timestamp), w.hostname, appName, w.pid)
+		buf.Write(msg)
+		return buf.Bytes()
+	}
+
+	// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ELEMENT]... MSG
+	fmt.Fprintf(&buf, "1 %s %s %s %d - ", t.Format(w.timestamp), w.hostname, appName, w.pid)
+	writeElement(&buf, id, params)
+	buf.WriteString(w.data)
+	buf.WriteByte(' ')
+	buf.Write(msg)
+	return buf.Bytes()
+}
+
+func (w *Writer) send(t time.Time, severity int, id string, params [][2]string, msg []byte) {
+	frame := w.message(t, severity, id, params, msg)
+
+	if w.network == "tcp" {
+		// octet counting framing (RFC 6587)
+		frame = append([]byte(strconv.Itoa(len(frame))+" "), frame...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		w.dropped++
+		return
+	}
+
+	if len(w.queue) >= maxQueue {
+		w.queue = w.queue[1:]
+		w.dropped++
+	}
+	w.queue = append(w.queue, frame)
+	w.cond.Signal()
+}
+
+// run sends the queued messages, reconnecting with a backoff whenever the connection fails
+func (w *Writer) run() {
+	defer close(w.done)
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	backoff := minBackoff
+
+	for {
+		select {
+		case <-w.closing:
+			return
+		default:
+		}
+
+		// the message being sent is taken off the queue, so a full queue can't drop it until it has been written
+		w.mu.Lock()
+		if w.sending == nil {
+			for len(w.queue) == 0 && !w.closed {
+				w.cond.Wait()
+			}
+			if len(w.queue) == 0 {
+				w.mu.Unlock()
+				return
+			}
+			w.sending = w.queue[0]
+			w.queue = w.queue[1:]
+		}
+		frame := w.sending
+		w.mu.Unlock()
+
+		if conn == nil {
+			var err error
+			if conn, err = w.dial(); err != nil {
+				// the logs can't be used to report a failure to write the logs
+				fmt.Fprintf(os.Stderr, "syslog: failed to connect to %s: %v\n", w.address, err)
+
+				select {
+				case <-time.After(backoff):
+				case <-w.closing:
+					return
+				}
+
+				if backoff *= 2; backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+				continue
+			}
+			backoff = minBackoff
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(frame); err != nil {
+			fmt.Fprintf(os.Stderr, "syslog: failed to write to %s: %v\n", w.address, err)
+			conn.Close()
+			conn = nil
+			continue
+		}
+
+		w.mu.Lock()
+		w.sending = nil
+		w.mu.Unlock()
+	}
+}
+
+func (w *Writer) dial() (net.Conn, error) {
+	if w.network != "unix" {
+		return net.DialTimeout(w.network, w.address, time.Second*5)
+	}
+
+	// the local syslog socket (e.g. /dev/log) is usually a datagram socket
+	conn, err := net.Dial("unixgram", w.address)
+	if err != nil {
+		conn, err = net.Dial("unix", w.address)
+	}
+
+	return conn, err
+}
+
+// writeElement writes a structured data element, parameters with empty values are left out
+func writeElement(buf *bytes.Buffer, id string, params [][2]string) {
+	buf.WriteString("[" + id)
+	for _, param := range params {
+		if param[1] == "" || !validName(param[0]) {
+			continue
+		}
+		buf.WriteString(" " + param[0] + `="`)
+		buf.WriteString(escapeParam(param[1]))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte(']')
+}
+
+func sortedParams(params map[string]string) [][2]string {
+	sorted := make([][2]string, 0, len(params))
+	for name, value := range params {
+		sorted = append(sorted, [2]string{name, value})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+
+	return sorted
+}
+
+// validName checks an SD-ID or PARAM-NAME, 1-32 printable characters except = ] " and space
+func validName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// escapeParam escapes ", \, and ] in a PARAM-VALUE
+func escapeParam(value string) string {
+	var buf strings.Builder
+	for _, r := range value {
+		if r == '"' || r == '\\' || r == ']' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
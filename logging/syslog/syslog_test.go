@@ -0,0 +1,208 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+)
+
+// readFrame reads a single octet counted message
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatalf("failed to read frame length: %v", err)
+	}
+
+	size, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		t.Fatalf("invalid frame length %q", length)
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+
+	return string(frame)
+}
+
+func accept(t *testing.T, ln net.Listener) *bufio.Reader {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+
+	return bufio.NewReader(conn)
+}
+
+func TestTCPRFC5424(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	w, err := New(Options{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		Facility: "local7",
+		RFC:      "rfc5424micro",
+		Format:   access.Common,
+		Data:     []StructuredData{{ID: "example@0", Params: map[string]string{"site": `example.org "main"`}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	defer w.Close()
+
+	w.Log(&logging.Message{Time: time.Now(), Level: logging.LevelWarn, RequestID: "abc-123", Text: "disk full"})
+	w.Access(&access.Entry{
+		Time:       time.Date(2017, 10, 10, 8, 0, 0, 0, time.UTC),
+		RemoteAddr: "127.0.0.1",
+		Method:     "GET",
+		URI:        "/api/[test]",
+		Proto:      "HTTP/1.1",
+		Status:     502,
+	})
+
+	r := accept(t, ln)
+
+	app := regexp.MustCompile(`^<188>1 \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}(Z|[+-]\d{2}:\d{2}) \S+ gateway \d+ - ` +
+		`\[gateway@20171010 level="WARN" request_id="abc-123"\]\[example@0 site="example.org \\"main\\""\] disk full$`)
+	if frame := readFrame(t, r); !app.MatchString(frame) {
+		t.Errorf("unexpected application message: %q", frame)
+	}
+
+	accessLine := regexp.MustCompile(`^<187>1 2017-10-10T08:00:00\.000000Z \S+ gateway \d+ - ` +
+		`\[gatewayHTTP@20171010 method="GET" uri="/api/\[test\\\]" status="502"\]\[example@0 [^]]+\] ` +
+		`127\.0\.0\.1 - - \[10/Oct/2017:08:00:00 \+0000\] "GET /api/\[test\] HTTP/1\.1" 502 -$`)
+	if frame := readFrame(t, r); !accessLine.MatchString(frame) {
+		t.Errorf("unexpected access message: %q", frame)
+	}
+}
+
+func TestUDPRFC3164(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	w, err := New(Options{Network: "udp", Address: conn.LocalAddr().String(), Facility: "daemon", RFC: "rfc3164"})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	defer w.Close()
+
+	w.Log(&logging.Message{Time: time.Date(2017, 10, 1, 8, 0, 0, 0, time.UTC), Level: logging.LevelDebug, Text: "hello"})
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+
+	expected := regexp.MustCompile(`^<31>Oct  1 08:00:00 \S+ gateway\[\d+\]: hello$`)
+	if message := string(buf[:n]); !expected.MatchString(message) {
+		t.Errorf("unexpected message: %q", message)
+	}
+}
+
+func TestReconnectSendsQueuedMessages(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	w, err := New(Options{Network: "tcp", Address: address, Facility: "local0"})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	defer w.Close()
+
+	w.Log(&logging.Message{Time: time.Now(), Level: logging.LevelInfo, Text: "queued"})
+
+	// the syslog server comes up after the message was logged
+	time.Sleep(minBackoff)
+	if ln, err = net.Listen("tcp", address); err != nil {
+		t.Skipf("failed to listen on %s again: %v", address, err)
+	}
+	defer ln.Close()
+
+	if frame := readFrame(t, accept(t, ln)); !strings.HasSuffix(frame, "] queued") {
+		t.Errorf("expected the queued message to be sent, got %q", frame)
+	}
+}
+
+func TestFullQueueKeepsSendingMessage(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	w, err := New(Options{Network: "tcp", Address: address, Facility: "local0"})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	defer w.Close()
+
+	w.Log(&logging.Message{Time: time.Now(), Level: logging.LevelInfo, Text: "first"})
+
+	// wait for the first message to be taken to send, then fill the queue past its limit
+	for deadline := time.Now().Add(time.Second * 5); ; time.Sleep(time.Millisecond) {
+		w.mu.Lock()
+		sending := w.sending != nil
+		w.mu.Unlock()
+		if sending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the first message was not taken to send")
+		}
+	}
+
+	for i := 0; i <= maxQueue; i++ {
+		w.Log(&logging.Message{Time: time.Now(), Level: logging.LevelInfo, Text: "message " + strconv.Itoa(i)})
+	}
+
+	if ln, err = net.Listen("tcp", address); err != nil {
+		t.Skipf("failed to listen on %s again: %v", address, err)
+	}
+	defer ln.Close()
+
+	r := accept(t, ln)
+	for _, expected := range []string{"] first", "] message 1", "] message 2"} {
+		if frame := readFrame(t, r); !strings.HasSuffix(frame, expected) {
+			t.Errorf("expected a message ending with %q, got %q", expected, frame)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	invalid := []Options{
+		{Network: "tcp", Facility: "local9"},
+		{Network: "tcp", Facility: "local7", RFC: "rfc1"},
+		{Network: "http", Facility: "local7"},
+		{Network: "tcp", Facility: "local7", Data: []StructuredData{{ID: "bad id"}}},
+	}
+
+	for _, options := range invalid {
+		if _, err := New(options); err == nil {
+			t.Errorf("expected %+v to be invalid", options)
+		}
+	}
+}
@@ -4,18 +4,40 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"sort"
+	"syscall"
 	"time"
 
 	"github.com/renevo/gateway/config"
+	"github.com/renevo/gateway/dns"
 	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+	"github.com/renevo/gateway/logging/file"
+	"github.com/renevo/gateway/logging/syslog"
+	"github.com/renevo/gateway/metrics"
+	"github.com/renevo/gateway/monitoring"
 	"github.com/renevo/gateway/server"
+	"github.com/renevo/gateway/server/cors"
+	"github.com/renevo/gateway/server/headers"
+	"github.com/renevo/gateway/server/openapi"
+	"github.com/renevo/gateway/server/proxy"
+	"github.com/renevo/gateway/server/realip"
+	"github.com/renevo/gateway/systemd"
+	"github.com/renevo/gateway/tracing"
 )
 
+// version is set at build time with -ldflags "-X main.version=<version>"
+var version = "dev"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validate(os.Args[2:]))
+	}
+
 	cfgFile := flag.String("config", "", "path to configuration file")
 	flag.Parse()
 
@@ -40,10 +62,205 @@ func main() {
 		gatewayConfig = config.DefaultConfiguration()
 	}
 
+	if err := configureLogging(gatewayConfig.Monitoring.Logging); err != nil {
+		panic(fmt.Errorf("invalid logging configuration: %v", err))
+	}
+
+	corsPolicy, err := newCORSPolicy(gatewayConfig.Site.CORS, gatewayConfig.Site.Headers.ExtraHeaders)
+	if err != nil {
+		panic(fmt.Errorf("invalid cors configuration: %v", err))
+	}
+
+	headerConfig := gatewayConfig.Site.Headers
+	headerOptions := headers.Options{
+		Strip:     headerConfig.Blacklist,
+		Append:    headerConfig.ExtraHeaders,
+		RequestID: headerConfig.IncludeRequestID,
+		Debug:     headerConfig.IncludeDebug,
+	}
+
+	if headerConfig.IncludeServer {
+		headerOptions.Server = "gateway/" + version
+	}
+
+	realIP, err := realip.New(gatewayConfig.Site.TrustedProxies)
+	if err != nil {
+		panic(fmt.Errorf("invalid trusted proxies: %v", err))
+	}
+
 	// build our server up
-	server := server.New(
+	options := []server.Option{
+		server.Headers(headers.New(headerOptions)),
 		server.MountSite(gatewayConfig.Site.Content.Path),
-	)
+		server.ErrorPages(gatewayConfig.Site.Content.Errors),
+		server.ContentTimeout(gatewayConfig.Site.Content.Timeout),
+		server.CORS(corsPolicy),
+		server.RequestID(headerConfig.IncludeRequestID, headerConfig.TrustRequestID),
+		server.RealIP(realIP, gatewayConfig.Monitoring.Logging.ParseRealIP),
+	}
+
+	var resolver *dns.Resolver
+	if gatewayConfig.DNS.Address != "" {
+		dnsAddress, err := gatewayConfig.DNS.Address.URL()
+		if err != nil {
+			panic(fmt.Errorf("failed to parse dns address %q: %v", gatewayConfig.DNS.Address, err))
+		}
+
+		resolver, err = dns.New(dnsAddress, gatewayConfig.DNS.Domains)
+		if err != nil {
+			panic(fmt.Errorf("failed to create dns resolver %q: %v", gatewayConfig.DNS.Address, err))
+		}
+	}
+
+	site := gatewayConfig.Site
+	validating := false
+	for _, service := range site.Services {
+		serviceAddress, err := service.Address.URL()
+		if err != nil {
+			panic(fmt.Errorf("failed to parse service address %q: %v", service.Address, err))
+		}
+
+		validation, err := openapi.ParseMode(service.Validation)
+		if err != nil {
+			panic(fmt.Errorf("invalid validation for service %q: %v", service.Path, err))
+		}
+
+		if validation != openapi.Off {
+			if service.OpenAPI == "" {
+				panic(fmt.Errorf("service %q validates requests without a spec", service.Path))
+			}
+			validating = true
+		}
+
+		serviceOptions := []proxy.Option{
+			proxy.Retry(site.Retry.Count, site.Retry.Delay, site.Retry.Timeout),
+			proxy.CircuitBreaker(site.Breaker.Ratio, site.Breaker.Minimum, site.Breaker.Window, site.Breaker.Cooldown),
+			proxy.Timeouts(service.ConnectTimeout, service.ReadTimeout),
+			proxy.IdleTimeout(service.IdleTimeout),
+			proxy.Resolver(resolver),
+			proxy.Spec(service.OpenAPI),
+			proxy.Validate(validation),
+		}
+
+		if service.CORS != nil {
+			servicePolicy, err := newCORSPolicy(site.CORS.Merge(service.CORS), site.Headers.ExtraHeaders)
+			if err != nil {
+				panic(fmt.Errorf("invalid cors configuration for service %q: %v", service.Path, err))
+			}
+			serviceOptions = append(serviceOptions, proxy.CORS(servicePolicy))
+		}
+
+		options = append(options, server.MountService(proxy.New(service.Path, serviceAddress, serviceOptions...)))
+	}
+
+	// the service specifications are fetched to validate requests even when the merged specification isn't served
+	if specConfig := site.OpenAPI; specConfig.Path != "" || validating {
+		options = append(options, server.OpenAPI(specConfig.Path, specConfig.UIPath, openapi.New(version, specConfig.Refresh)))
+	}
+
+	var metricsClient *metrics.Client
+	if metricsConfig := gatewayConfig.Monitoring.Metrics; metricsConfig.Address != "" {
+		metricsAddress, err := metricsConfig.Address.URL()
+		if err != nil {
+			panic(fmt.Errorf("failed to parse metrics address %q: %v", metricsConfig.Address, err))
+		}
+
+		metricsClient, err = metrics.New(metrics.Options{
+			Prefix:   metricsConfig.Prefix,
+			Site:     metricsConfig.Includes.Site,
+			Sites:    site.Hosts,
+			Host:     metricsConfig.Includes.Host,
+			Path:     metricsConfig.Includes.Path,
+			Method:   metricsConfig.Includes.Method,
+			TagSets:  metricsConfig.TagSets,
+			Tags:     metricsConfig.Tags,
+			Network:  metricsAddress.Scheme,
+			Address:  metricsAddress.Host,
+			Format:   metricsConfig.Format,
+			Interval: metricsConfig.Interval,
+		})
+		if err != nil {
+			panic(fmt.Errorf("invalid metrics configuration: %v", err))
+		}
+		options = append(options, server.Metrics(metricsClient))
+	}
+
+	var tracer *tracing.Tracer
+	if tracingConfig := gatewayConfig.Monitoring.Tracing; tracingConfig.Address != "" {
+		tracingAddress, err := tracingConfig.Address.URL()
+		if err != nil {
+			panic(fmt.Errorf("failed to parse tracing address %q: %v", tracingConfig.Address, err))
+		}
+
+		tracer, err = tracing.New(tracing.Options{
+			Endpoint:    tracingAddress,
+			ServiceName: tracingConfig.ServiceName,
+			Version:     version,
+			Interval:    tracingConfig.Interval,
+		})
+		if err != nil {
+			panic(fmt.Errorf("invalid tracing configuration: %v", err))
+		}
+		options = append(options, server.Tracing(tracer))
+	}
+
+	var monitor *monitoring.Server
+	var activity *monitoring.Activity
+	if monitorConfig := gatewayConfig.Monitoring.HTTP; monitorConfig.Enabled {
+		monitor = monitoring.New(monitorConfig.Path)
+		activity = monitoring.NewActivity()
+
+		history := monitoring.NewHistory(monitorConfig.History.Size, monitorConfig.History.Slowest, monitorConfig.History.Window)
+		monitor.History(history)
+
+		options = append(options, server.Metrics(activity, history))
+	}
+
+	var prometheus *metrics.Prometheus
+	if promConfig := gatewayConfig.Monitoring.Metrics.Prometheus; promConfig.Enabled && monitor != nil {
+		prometheus = metrics.NewPrometheus(promConfig.Buckets, site.Hosts)
+		options = append(options, server.Metrics(prometheus))
+		monitor.Handle("/metrics", prometheus)
+	}
+
+	gateway := server.New(options...)
+
+	if prometheus != nil {
+		prometheus.Collect(gateway.Collect)
+	}
+
+	if monitor != nil {
+		monitor.API(gatewayConfig, gateway, activity)
+
+		health := monitoring.NewHealth(version)
+		health.Check("listeners", func() error {
+			if bound, configured := len(gateway.Listening()), len(gatewayConfig.Site.Listeners); bound < configured {
+				return fmt.Errorf("%d of %d listeners bound", bound, configured)
+			}
+			return nil
+		})
+		health.Check("content", gateway.ContentErr)
+		// services are only configured statically until a discovery mode is implemented, so they are always in sync
+		health.Check("discovery", func() error { return nil })
+		monitor.Health(health)
+
+		monitorConfig := gatewayConfig.Monitoring.HTTP
+		monitorAddress, err := monitorConfig.Address.URL()
+		if err != nil {
+			panic(fmt.Errorf("failed to parse monitoring address %q: %v", monitorConfig.Address, err))
+		}
+
+		var cert, key string
+		if monitorConfig.TLS != nil {
+			cert, key = monitorConfig.TLS.CertificatePath, monitorConfig.TLS.KeyPath
+		}
+
+		go func() {
+			if err := monitor.Listen(monitorAddress, cert, key); err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}()
+	}
 
 	for _, listener := range gatewayConfig.Site.Listeners {
 		listenerAddress, err := listener.Address.URL()
@@ -51,21 +268,209 @@ func main() {
 			panic(fmt.Errorf("failed to parse listener address %q: %v", listener.Address, err))
 		}
 
+		timeouts := server.Timeouts{
+			ReadHeader: listener.ReadHeaderTimeout,
+			Read:       listener.ReadTimeout,
+			Write:      listener.WriteTimeout,
+			Idle:       listener.IdleTimeout,
+		}
+
+		// bound before serving, so systemd is only told the gateway is ready once every listener is
+		ln, err := server.Bind(listenerAddress)
+		if err != nil {
+			panic(fmt.Errorf("failed to listen on %q: %v", listener.Address, err))
+		}
+
 		// TODO: handle tls vs non-tls
-		go func(addr *url.URL) {
-			if err := server.Listen(addr); err != nil && err != http.ErrServerClosed {
+		go func(ln net.Listener) {
+			if err := gateway.Serve(ln, timeouts); err != nil && err != http.ErrServerClosed {
 				panic(err)
 			}
-		}(listenerAddress)
+		}(ln)
 	}
 
+	stopWatchdog := make(chan struct{})
+	go systemd.Watchdog(systemd.WatchdogInterval(), stopWatchdog)
+	systemd.Notify("READY=1")
+
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 
+	systemd.Notify("STOPPING=1")
+	close(stopWatchdog)
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 	logging.Info("Gateway shutting down")
-	server.Shutdown(ctx)
+	if monitor != nil {
+		monitor.Shutdown(ctx)
+	}
+	gateway.Shutdown(ctx)
+	if metricsClient != nil {
+		metricsClient.Close()
+	}
+	if tracer != nil {
+		tracer.Close()
+	}
 	logging.Info("Gateway shutdown")
+	logging.Close()
+}
+
+// validate checks the configuration file without starting the gateway, listing every problem found
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	cfgFile := flags.String("config", "", "path to configuration file")
+	flags.Parse(args)
+
+	if *cfgFile == "" {
+		fmt.Fprintln(os.Stderr, "usage: gateway validate -config <file>")
+		return 2
+	}
+
+	f, err := os.Open(*cfgFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read configuration file %s: %v\n", *cfgFile, err)
+		return 1
+	}
+
+	_, err = config.LoadConfiguration(f)
+	f.Close()
+
+	if errs, ok := err.(config.Errors); ok {
+		fmt.Fprintf(os.Stderr, "%s is invalid:\n", *cfgFile)
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "  %v\n", e)
+		}
+		return 1
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *cfgFile, err)
+		return 1
+	}
+
+	fmt.Printf("%s is valid\n", *cfgFile)
+	return 0
+}
+
+// newCORSPolicy creates the cors policy, headers appended to every response are always readable by cross origin clients
+func newCORSPolicy(cfg config.CORSConfiguration, appended map[string]string) (*cors.Policy, error) {
+	exposed := append([]string{}, cfg.ResponseHeaders...)
+	for header := range appended {
+		exposed = append(exposed, header)
+	}
+	sort.Strings(exposed[len(cfg.ResponseHeaders):])
+
+	return cors.New(cors.Options{
+		Disable:          cfg.DisableAll,
+		Handle:           cfg.Hijack,
+		Origins:          cfg.Origins,
+		Methods:          cfg.Methods,
+		RequestHeaders:   cfg.RequestHeaders,
+		ResponseHeaders:  exposed,
+		AllowCredentials: cfg.AllowAuthentication,
+	})
+}
+
+// configureLogging sets the minimum application log level and where the logs are written
+func configureLogging(cfg config.LoggingConfiguration) error {
+	if cfg.Level != "" {
+		level, err := logging.ParseLevel(cfg.Level)
+		if err != nil {
+			return err
+		}
+		logging.SetLevel(level)
+	}
+
+	var outputs []logging.Output
+
+	if systemdConfig := cfg.Outputs.Systemd; systemdConfig.Format != "" && systemd.Detected() {
+		// the journal already captures stdout, so this replaces the std output
+		format, err := access.New(systemdConfig.Format)
+		if err != nil {
+			return err
+		}
+
+		if systemdConfig.Journal {
+			journal, err := systemd.NewJournal(format)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, journal)
+		} else {
+			outputs = append(outputs, systemd.NewStream(os.Stdout, format))
+		}
+	} else {
+		format, err := access.New(cfg.Outputs.Stdout.Format)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, logging.NewStream(os.Stdout, os.Stderr, format))
+	}
+
+	if syslogConfig := cfg.Outputs.Syslog; syslogConfig.Address != "" {
+		address, err := syslogConfig.Address.URL()
+		if err != nil {
+			return fmt.Errorf("invalid syslog address %q: %v", syslogConfig.Address, err)
+		}
+
+		syslogFormat, err := access.New(syslogConfig.Format)
+		if err != nil {
+			return err
+		}
+
+		options := syslog.Options{
+			Network:  address.Scheme,
+			Address:  address.Host,
+			Facility: syslogConfig.Facility,
+			RFC:      syslogConfig.RFC,
+			Format:   syslogFormat,
+		}
+
+		if address.Scheme == "unix" {
+			options.Address = address.Path
+		}
+
+		for _, data := range syslogConfig.StructuredData {
+			options.Data = append(options.Data, syslog.StructuredData{ID: data.SDID, Params: data.Values})
+		}
+
+		writer, err := syslog.New(options)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, writer)
+	}
+
+	if fileConfig := cfg.Outputs.File; fileConfig.Path != "" {
+		fileFormat, err := access.New(fileConfig.Format)
+		if err != nil {
+			return err
+		}
+
+		writer, err := file.New(file.Options{
+			Path:    fileConfig.Path,
+			Format:  fileFormat,
+			MaxSize: fileConfig.MaxSize * 1024 * 1024,
+			MaxAge:  fileConfig.MaxAge,
+			Keep:    fileConfig.Keep,
+		})
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, writer)
+
+		// logrotate moves the file and sends SIGUSR1 (postrotate) to start a new one
+		reopen := make(chan os.Signal, 1)
+		signal.Notify(reopen, syscall.SIGUSR1)
+		go func() {
+			for range reopen {
+				writer.Reopen()
+			}
+		}()
+	}
+
+	logging.SetOutputs(outputs...)
+	return nil
 }
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// metric types
+const (
+	typeCounter = "c"
+	typeTimer   = "ms"
+)
+
+// tag is a tag set (name:value) or a plain tag when the value is empty
+type tag struct {
+	name  string
+	value string
+}
+
+// format renders a single metric line, a rate below 1 is the fraction of the values that were sampled
+type format func(name string, value float64, kind string, rate float64, tags []tag) string
+
+var formats = map[string]format{
+	"statsd":    formatStatsd,
+	"dogstatsd": formatDogStatsd,
+	"influxdb":  formatInfluxDB,
+	"statsite":  formatStatsd,
+}
+
+// ValidFormat returns true when the metrics format is supported, empty uses statsd
+func ValidFormat(name string) bool {
+	_, ok := formats[name]
+	return ok || name == ""
+}
+
+// formatStatsd renders metric.name:value|type|@sample_rate, tags are not supported
+//
+// statsite uses the same format for counters and timers.
+func formatStatsd(name string, value float64, kind string, rate float64, tags []tag) string {
+	return name + ":" + formatValue(value) + "|" + kind + sampleRate(rate)
+}
+
+// formatDogStatsd renders metric.name:value|type|@sample_rate|#tag1:value,tag2
+func formatDogStatsd(name string, value float64, kind string, rate float64, tags []tag) string {
+	line := formatStatsd(name, value, kind, rate, nil)
+	if len(tags) == 0 {
+		return line
+	}
+
+	rendered := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t.value == "" {
+			rendered = append(rendered, t.name)
+		} else {
+			rendered = append(rendered, t.name+":"+t.value)
+		}
+	}
+
+	return line + "|#" + strings.Join(rendered, ",")
+}
+
+// formatInfluxDB renders metric.name,tag1:value,tag2:value|type|@sample_rate
+func formatInfluxDB(name string, value float64, kind string, rate float64, tags []tag) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, t := range tags {
+		if t.value == "" {
+			b.WriteString("," + t.name)
+		} else {
+			fmt.Fprintf(&b, ",%s:%s", t.name, t.value)
+		}
+	}
+
+	return b.String() + ":" + formatValue(value) + "|" + kind + sampleRate(rate)
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// sampleRate renders the |@sample_rate suffix, nothing when every value was sent
+func sampleRate(rate float64) string {
+	if rate <= 0 || rate >= 1 {
+		return ""
+	}
+
+	return "|@" + strconv.FormatFloat(rate, 'g', 4, 64)
+}
+
+// segment makes a value safe to use as part of a metric name or tag, anything other than letters, digits, - and _ becomes _
+func segment(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, value)
+}
@@ -0,0 +1,340 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+)
+
+const (
+	defaultInterval = time.Second * 10
+
+	// maxPacket keeps every packet within a single ethernet frame (1500 MTU less the IP and UDP headers, with room for options)
+	maxPacket = 1432
+
+	// maxTimerSamples limits the response times kept for a single metric between flushes, beyond it the times are sampled
+	maxTimerSamples = 1000
+)
+
+// Recorder receives every completed request
+type Recorder interface {
+	Record(e *access.Entry)
+}
+
+// Options defines the metric names and where they are sent
+type Options struct {
+	// Prefix of every metric name
+	Prefix string
+	// Site includes the requested site in the metric names
+	Site bool
+	// Sites are the host names of the site, any other requested host is named other (default when there are none)
+	Sites []string
+	// Host includes the host name of the gateway in the metric names
+	Host bool
+	// Path includes the mounted path that served the request in the metric names
+	Path bool
+	// Method includes the request method in the metric names
+	Method bool
+	// TagSets are name:value tags, values are templates with {{ .Hostname }} available
+	TagSets map[string]string
+	// Tags are plain tags
+	Tags []string
+	// Network is udp
+	Network string
+	// Address of the stats server
+	Address string
+	// Format of the stats messages: statsd, dogstatsd, influxdb, or statsite
+	Format string
+	// Interval between sending the aggregated metrics, defaults to 10s
+	Interval time.Duration
+}
+
+// Client aggregates request metrics and sends them to a statsd compatible server
+//
+// For each request these metrics are sent:
+//
+//	<name>.requests (counter)
+//	<name>.responses.<status class> (counter, e.g. responses.2xx)
+//	<name>.response.time (timer in milliseconds)
+//	<name>.response.bytes (counter)
+type Client struct {
+	options  Options
+	hostname string
+	format   format
+	tags     []tag
+	sites    map[string]bool
+	conn     net.Conn
+
+	mu       sync.Mutex
+	counters map[string]float64
+	timers   map[string]*timer
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// timer is a uniform sample (reservoir) of the values recorded for a timer metric
+type timer struct {
+	values []float64
+	seen   int
+}
+
+func (t *timer) add(value float64) {
+	t.seen++
+	if len(t.values) < maxTimerSamples {
+		t.values = append(t.values, value)
+		return
+	}
+
+	if i := rand.Intn(t.seen); i < maxTimerSamples {
+		t.values[i] = value
+	}
+}
+
+// rate is the fraction of the recorded values that were kept
+func (t *timer) rate() float64 {
+	return float64(len(t.values)) / float64(t.seen)
+}
+
+// New creates the client and starts sending the metrics at the interval
+func New(options Options) (*Client, error) {
+	if options.Format == "" {
+		options.Format = "statsd"
+	}
+
+	f, ok := formats[options.Format]
+	if !ok {
+		return nil, fmt.Errorf("unknown metrics format %q", options.Format)
+	}
+
+	if options.Network != "udp" {
+		return nil, fmt.Errorf("unsupported metrics network %q", options.Network)
+	}
+
+	if options.Interval <= 0 {
+		options.Interval = defaultInterval
+	}
+
+	hostname, _ := os.Hostname()
+
+	tags, err := renderTags(options.TagSets, options.Tags, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial(options.Network, options.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		options:  options,
+		hostname: hostname,
+		format:   f,
+		tags:     tags,
+		sites:    siteSet(options.Sites),
+		conn:     conn,
+		counters: make(map[string]float64),
+		timers:   make(map[string]*timer),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go c.run()
+
+	return c, nil
+}
+
+func renderTags(tagSets map[string]string, plain []string, hostname string) ([]tag, error) {
+	data := struct{ Hostname string }{hostname}
+
+	names := make([]string, 0, len(tagSets))
+	for name := range tagSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tags []tag
+	for _, name := range names {
+		tmpl, err := template.New(name).Parse(tagSets[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics tag %q: %v", name, err)
+		}
+
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, data); err != nil {
+			return nil, fmt.Errorf("invalid metrics tag %q: %v", name, err)
+		}
+
+		tags = append(tags, tag{name: segment(name), value: segment(value.String())})
+	}
+
+	for _, name := range plain {
+		tags = append(tags, tag{name: segment(name)})
+	}
+
+	return tags, nil
+}
+
+// Record aggregates the metrics of a completed request
+func (c *Client) Record(e *access.Entry) {
+	name := c.name(e)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counters[name+".requests"]++
+	c.counters[name+".responses."+strconv.Itoa(e.Status/100)+"xx"]++
+	c.counters[name+".response.bytes"] += float64(e.Size)
+
+	t, ok := c.timers[name+".response.time"]
+	if !ok {
+		t = &timer{}
+		c.timers[name+".response.time"] = t
+	}
+	t.add(float64(e.Duration.Microseconds()) / 1000)
+}
+
+// name returns the metric name for the request: <prefix>.site.<site>.host.<hostname>.path.<path>.method.<method>
+func (c *Client) name(e *access.Entry) string {
+	parts := []string{}
+	if c.options.Prefix != "" {
+		parts = append(parts, c.options.Prefix)
+	}
+
+	if c.options.Site {
+		parts = append(parts, "site", segment(siteName(c.sites, e.Host)))
+	}
+
+	if c.options.Host {
+		parts = append(parts, "host", segment(c.hostname))
+	}
+
+	if c.options.Path {
+		parts = append(parts, "path", pathName(e.Route))
+	}
+
+	if c.options.Method {
+		parts = append(parts, "method", segment(strings.ToLower(e.Method)))
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// pathName converts a mounted path (/api/test) to metric name segments (api.test), the site root is root
+func pathName(path string) string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, segment(s))
+		}
+	}
+
+	if len(segments) == 0 {
+		return "root"
+	}
+
+	return strings.Join(segments, ".")
+}
+
+// Close sends the remaining metrics and stops the client
+func (c *Client) Close() error {
+	close(c.stop)
+	<-c.done
+	return c.conn.Close()
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-c.stop:
+			c.flush()
+			return
+		}
+	}
+}
+
+// flush sends the aggregated metrics, batching as many lines as fit in a packet
+func (c *Client) flush() {
+	c.mu.Lock()
+	counters, timers := c.counters, c.timers
+	c.counters = make(map[string]float64)
+	c.timers = make(map[string]*timer)
+	c.mu.Unlock()
+
+	var lines []string
+	for _, name := range sortedKeys(counters) {
+		lines = append(lines, c.format(name, counters[name], typeCounter, 1, c.tags))
+	}
+
+	timerNames := make([]string, 0, len(timers))
+	for name := range timers {
+		timerNames = append(timerNames, name)
+	}
+	sort.Strings(timerNames)
+
+	for _, name := range timerNames {
+		t := timers[name]
+		for _, value := range t.values {
+			lines = append(lines, c.format(name, value, typeTimer, t.rate(), c.tags))
+		}
+	}
+
+	for _, packet := range batch(lines, maxPacket) {
+		if _, err := c.conn.Write(packet); err != nil {
+			logging.Debugf("Failed to send metrics to %s: %v", c.options.Address, err)
+		}
+	}
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// batch joins the lines with new lines into packets no larger than size, a single line larger than size is sent on its own
+func batch(lines []string, size int) [][]byte {
+	var packets [][]byte
+	var packet []byte
+
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > size {
+			packets = append(packets, packet)
+			packet = nil
+		}
+
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+
+	return packets
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+var entry = &access.Entry{
+	Method:   "GET",
+	Host:     "www.example.org:8080",
+	Route:    "/api/test/",
+	Status:   200,
+	Size:     512,
+	Duration: time.Millisecond * 50,
+}
+
+func TestFormats(t *testing.T) {
+	tags := []tag{{name: "role", value: "gateway"}, {name: "http"}}
+
+	expected := map[string]string{
+		"statsd":    "gateway.requests:1|c",
+		"dogstatsd": "gateway.requests:1|c|#role:gateway,http",
+		"influxdb":  "gateway.requests,role:gateway,http:1|c",
+		"statsite":  "gateway.requests:1|c",
+	}
+
+	for name, line := range expected {
+		if actual := formats[name]("gateway.requests", 1, typeCounter, 1, tags); actual != line {
+			t.Errorf("%s: expected %q, got %q", name, line, actual)
+		}
+	}
+
+	sampled := map[string]string{
+		"statsd":    "gateway.response.time:50|ms|@0.25",
+		"dogstatsd": "gateway.response.time:50|ms|@0.25|#role:gateway,http",
+		"influxdb":  "gateway.response.time,role:gateway,http:50|ms|@0.25",
+		"statsite":  "gateway.response.time:50|ms|@0.25",
+	}
+
+	for name, line := range sampled {
+		if actual := formats[name]("gateway.response.time", 50, typeTimer, 0.25, tags); actual != line {
+			t.Errorf("%s: expected %q, got %q", name, line, actual)
+		}
+	}
+}
+
+func TestTimerSamples(t *testing.T) {
+	samples := &timer{}
+	for i := 0; i < maxTimerSamples*4; i++ {
+		samples.add(float64(i))
+	}
+
+	if len(samples.values) != maxTimerSamples {
+		t.Errorf("expected %d samples, got %d", maxTimerSamples, len(samples.values))
+	}
+
+	if rate := samples.rate(); rate != 0.25 {
+		t.Errorf("expected a sample rate of 0.25, got %v", rate)
+	}
+
+	// a uniform sample keeps values from the whole flush, not only the first
+	late := 0
+	for _, value := range samples.values {
+		if value >= maxTimerSamples {
+			late++
+		}
+	}
+	if late == 0 {
+		t.Errorf("expected samples of the values recorded after the first %d", maxTimerSamples)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	packets := batch([]string{"aaaa", "bbbb", "cccc", strings.Repeat("d", 12)}, 10)
+
+	expected := []string{"aaaa\nbbbb", "cccc", strings.Repeat("d", 12)}
+	if len(packets) != len(expected) {
+		t.Fatalf("expected %d packets, got %d: %q", len(expected), len(packets), packets)
+	}
+
+	for i, packet := range packets {
+		if string(packet) != expected[i] {
+			t.Errorf("packet %d: expected %q, got %q", i, expected[i], packet)
+		}
+	}
+}
+
+func TestClientSendsAggregatedMetrics(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	c, err := New(Options{
+		Prefix:   "gateway",
+		Site:     true,
+		Sites:    []string{"WWW.example.org"},
+		Path:     true,
+		Method:   true,
+		TagSets:  map[string]string{"host": "{{ .Hostname }}"},
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Format:   "dogstatsd",
+		Interval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	c.Record(entry)
+	c.Record(entry)
+	c.Close()
+
+	buf := make([]byte, maxPacket)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	tags := "|#host:" + segment(hostname)
+	name := "gateway.site.www_example_org.path.api.test.method.get"
+
+	expected := strings.Join([]string{
+		name + ".requests:2|c" + tags,
+		name + ".response.bytes:1024|c" + tags,
+		name + ".responses.2xx:2|c" + tags,
+		name + ".response.time:50|ms" + tags,
+		name + ".response.time:50|ms" + tags,
+	}, "\n")
+
+	if actual := string(buf[:n]); actual != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestSiteName(t *testing.T) {
+	sites := siteSet([]string{"www.example.org"})
+
+	tests := map[string]string{
+		"www.example.org:8080": "www.example.org",
+		"WWW.EXAMPLE.ORG":      "www.example.org",
+		"random.example.org":   "other",
+	}
+
+	for host, expected := range tests {
+		if actual := siteName(sites, host); actual != expected {
+			t.Errorf("%s: expected site %q, got %q", host, expected, actual)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(Options{Network: "udp", Format: "graphite"}); err == nil {
+		t.Errorf("expected an unknown format to return an error")
+	}
+
+	if _, err := New(Options{Network: "udp", Format: "statsd", TagSets: map[string]string{"host": "{{ .Missing"}}); err == nil {
+		t.Errorf("expected an invalid tag template to return an error")
+	}
+}
@@ -0,0 +1,277 @@
+package metrics
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+// DefaultBuckets are the request duration histogram buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Tracker is implemented by recorders that also track the requests being served
+type Tracker interface {
+	Started(route string)
+}
+
+// methods that are used as a label as is, anything else is OTHER
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodOptions: true, http.MethodConnect: true, http.MethodTrace: true,
+}
+
+// Prometheus records request metrics to be scraped in the Prometheus text exposition format
+//
+// Labels are kept to a bounded set of values: the site is one of the configured hosts (or other), the route is the mounted
+// path that served the request (never the request path), and unknown methods are OTHER.
+type Prometheus struct {
+	buckets []float64
+	sites   map[string]bool
+
+	mu         sync.Mutex
+	requests   map[[4]string]uint64
+	durations  map[[3]string]*histogram
+	inFlight   map[string]int64
+	collectors []func(e *Exposition)
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheus creates the recorder, without buckets the DefaultBuckets are used
+func NewPrometheus(buckets []float64, sites []string) *Prometheus {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	p := &Prometheus{
+		buckets:   sorted,
+		sites:     siteSet(sites),
+		requests:  make(map[[4]string]uint64),
+		durations: make(map[[3]string]*histogram),
+		inFlight:  make(map[string]int64),
+	}
+
+	return p
+}
+
+// Collect adds metrics from f to every scrape
+func (p *Prometheus) Collect(f func(e *Exposition)) {
+	p.mu.Lock()
+	p.collectors = append(p.collectors, f)
+	p.mu.Unlock()
+}
+
+// Started counts the request as in flight until it is recorded
+func (p *Prometheus) Started(route string) {
+	p.mu.Lock()
+	p.inFlight[route]++
+	p.mu.Unlock()
+}
+
+// Record adds the completed request
+func (p *Prometheus) Record(e *access.Entry) {
+	site, method := p.site(e.Host), e.Method
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inFlight[e.Route] > 0 {
+		p.inFlight[e.Route]--
+	}
+
+	p.requests[[4]string{site, e.Route, method, strconv.Itoa(e.Status)}]++
+
+	key := [3]string{site, e.Route, method}
+	h := p.durations[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(p.buckets))}
+		p.durations[key] = h
+	}
+
+	seconds := e.Duration.Seconds()
+	h.count++
+	h.sum += seconds
+	for i, bound := range p.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+func (p *Prometheus) site(host string) string {
+	return siteName(p.sites, host)
+}
+
+func siteSet(sites []string) map[string]bool {
+	set := make(map[string]bool, len(sites))
+	for _, site := range sites {
+		set[strings.ToLower(site)] = true
+	}
+
+	return set
+}
+
+// siteName returns the requested host when it is one of the sites, other for any other host, and default without sites
+func siteName(sites map[string]bool, host string) string {
+	if len(sites) == 0 {
+		return "default"
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if host = strings.ToLower(host); sites[host] {
+		return host
+	}
+
+	return "other"
+}
+
+// ServeHTTP writes the metrics in the text exposition format
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e := NewExposition()
+
+	p.mu.Lock()
+	for key, count := range p.requests {
+		e.Counter("gateway_http_requests_total", "Completed HTTP requests.", float64(count),
+			"site", key[0], "route", key[1], "method", key[2], "code", key[3])
+	}
+
+	keys := make([][3]string, 0, len(p.durations))
+	for key := range p.durations {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i][:], " ") < strings.Join(keys[j][:], " ")
+	})
+
+	for _, key := range keys {
+		e.histogram("gateway_http_request_duration_seconds", "HTTP request latency in seconds.", p.buckets, p.durations[key],
+			"site", key[0], "route", key[1], "method", key[2])
+	}
+
+	for route, count := range p.inFlight {
+		e.Gauge("gateway_http_requests_in_flight", "HTTP requests currently being served.", float64(count), "route", route)
+	}
+
+	collectors := p.collectors
+	p.mu.Unlock()
+
+	for _, collect := range collectors {
+		collect(e)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(e.Bytes())
+}
+
+// Exposition is a single scrape of metrics in the Prometheus text format
+type Exposition struct {
+	families map[string]*family
+}
+
+type family struct {
+	help    string
+	kind    string
+	samples []string
+}
+
+// NewExposition creates an empty exposition
+func NewExposition() *Exposition {
+	return &Exposition{families: make(map[string]*family)}
+}
+
+// Counter adds a counter sample, labels are name, value pairs
+func (e *Exposition) Counter(name, help string, value float64, labels ...string) {
+	e.add(name, "counter", help, name, value, labels)
+}
+
+// Gauge adds a gauge sample, labels are name, value pairs
+func (e *Exposition) Gauge(name, help string, value float64, labels ...string) {
+	e.add(name, "gauge", help, name, value, labels)
+}
+
+func (e *Exposition) histogram(name, help string, buckets []float64, h *histogram, labels ...string) {
+	bucket := func(le string) []string {
+		return append(append([]string{}, labels...), "le", le)
+	}
+
+	for i, bound := range buckets {
+		e.add(name, "histogram", help, name+"_bucket", float64(h.counts[i]), bucket(formatValue(bound)))
+	}
+	e.add(name, "histogram", help, name+"_bucket", float64(h.count), bucket("+Inf"))
+	e.add(name, "histogram", help, name+"_sum", h.sum, labels)
+	e.add(name, "histogram", help, name+"_count", float64(h.count), labels)
+}
+
+func (e *Exposition) add(name, kind, help, sample string, value float64, labels []string) {
+	f := e.families[name]
+	if f == nil {
+		f = &family{help: help, kind: kind}
+		e.families[name] = f
+	}
+
+	var b strings.Builder
+	b.WriteString(sample)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + formatValue(value))
+
+	f.samples = append(f.samples, b.String())
+}
+
+// Bytes renders the exposition, families are sorted by name and samples are sorted within each family
+//
+// Histogram samples keep their order, so the buckets stay together with their sum and count.
+func (e *Exposition) Bytes() []byte {
+	names := make([]string, 0, len(e.families))
+	for name := range e.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		f := e.families[name]
+		if f.kind != "histogram" {
+			sort.Strings(f.samples)
+		}
+
+		buf.WriteString("# HELP " + name + " " + f.help + "\n")
+		buf.WriteString("# TYPE " + name + " " + f.kind + "\n")
+		for _, sample := range f.samples {
+			buf.WriteString(sample + "\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
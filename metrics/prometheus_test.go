@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	p := NewPrometheus([]float64{0.1, 0.01}, []string{"www.example.org"})
+
+	p.Started(entry.Route)
+	p.Record(entry)
+
+	other := *entry
+	other.Host = "attacker.example.com"
+	other.Method = "BREW"
+	p.Record(&other)
+
+	p.Collect(func(e *Exposition) {
+		e.Gauge("gateway_upstream_up", "Upstream up.", 1, "route", "/api/test")
+	})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	body := rec.Body.String()
+	expected := []string{
+		"# TYPE gateway_http_requests_total counter",
+		`gateway_http_requests_total{site="www.example.org",route="/api/test/",method="GET",code="200"} 1`,
+		`gateway_http_requests_total{site="other",route="/api/test/",method="OTHER",code="200"} 1`,
+		"# TYPE gateway_http_request_duration_seconds histogram",
+		`gateway_http_request_duration_seconds_bucket{site="www.example.org",route="/api/test/",method="GET",le="0.01"} 0`,
+		`gateway_http_request_duration_seconds_bucket{site="www.example.org",route="/api/test/",method="GET",le="0.1"} 1`,
+		`gateway_http_request_duration_seconds_bucket{site="www.example.org",route="/api/test/",method="GET",le="+Inf"} 1`,
+		`gateway_http_request_duration_seconds_sum{site="www.example.org",route="/api/test/",method="GET"} 0.05`,
+		`gateway_http_request_duration_seconds_count{site="www.example.org",route="/api/test/",method="GET"} 1`,
+		`gateway_http_requests_in_flight{route="/api/test/"} 0`,
+		`gateway_upstream_up{route="/api/test"} 1`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, body)
+		}
+	}
+
+	if strings.Contains(body, "attacker") || strings.Contains(body, "BREW") {
+		t.Errorf("unbounded label values in:\n%s", body)
+	}
+}
+
+func TestPrometheusDefaultSiteAndEscaping(t *testing.T) {
+	p := NewPrometheus(nil, nil)
+	p.Record(&access.Entry{Host: "anything.example.org", Method: "GET", Route: "/", Status: 404})
+
+	if site := p.site("anything.example.org"); site != "default" {
+		t.Errorf("expected the default site, got %q", site)
+	}
+
+	e := NewExposition()
+	e.Counter("test_total", "Test.", 1, "label", "a \"quoted\"\nvalue")
+	if line := `test_total{label="a \"quoted\"\nvalue"} 1`; !strings.Contains(string(e.Bytes()), line) {
+		t.Errorf("expected %q in:\n%s", line, e.Bytes())
+	}
+}
@@ -0,0 +1,232 @@
+package monitoring
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+const (
+	// historySeconds is how many one second slots are kept, enough for the largest window
+	historySeconds = 15 * 60
+
+	// streamBuffer is how many summaries a slow stream can fall behind before summaries are dropped
+	streamBuffer = 64
+)
+
+// windows are the rolling windows the request statistics are reported over
+var windows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", time.Minute * 5},
+	{"15m", time.Minute * 15},
+}
+
+// latencyBounds are the upper bounds (in milliseconds) of the buckets used to estimate the latency percentiles
+//
+// The bounds grow by 1.5x from 0.5ms to a little over 2 minutes, so an estimate is never more than 50% above the actual value.
+var latencyBounds = func() []float64 {
+	bounds := make([]float64, 32)
+	for i := range bounds {
+		bounds[i] = 0.5 * math.Pow(1.5, float64(i))
+	}
+	return bounds
+}()
+
+// Summary is a completed request sent to the live stream and kept in the history
+type Summary struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host"`
+	URI        string    `json:"uri"`
+	Route      string    `json:"route"`
+	Upstream   string    `json:"upstream,omitempty"`
+	Status     int       `json:"status"`
+	Size       int64     `json:"size"`
+	Duration   float64   `json:"duration_ms"`
+}
+
+// Window is the request statistics over a rolling window
+type Window struct {
+	Window    string  `json:"window"`
+	Requests  uint64  `json:"requests"`
+	Rate      float64 `json:"rate"`
+	Errors    uint64  `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P50       float64 `json:"p50_ms"`
+	P90       float64 `json:"p90_ms"`
+	P99       float64 `json:"p99_ms"`
+}
+
+// slot is the requests completed within a single second
+type slot struct {
+	second   int64
+	requests uint64
+	errors   uint64
+	latency  []uint64
+}
+
+// Activity records the recent requests for the dashboard, it is a metrics recorder
+//
+// Requests are counted in one second slots, a response with a 5xx status is an error.
+type Activity struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	slots   []slot
+	streams map[chan Summary]struct{}
+}
+
+// NewActivity creates an empty activity recorder
+func NewActivity() *Activity {
+	a := &Activity{
+		now:     time.Now,
+		slots:   make([]slot, historySeconds),
+		streams: make(map[chan Summary]struct{}),
+	}
+
+	for i := range a.slots {
+		a.slots[i].second = -1
+		a.slots[i].latency = make([]uint64, len(latencyBounds)+1)
+	}
+
+	return a
+}
+
+func summarize(e *access.Entry) Summary {
+	return Summary{
+		Time:       e.Time,
+		RequestID:  e.RequestID,
+		RemoteAddr: e.RemoteAddr,
+		Method:     e.Method,
+		Host:       e.Host,
+		URI:        e.URI,
+		Route:      e.Route,
+		Upstream:   e.Upstream,
+		Status:     e.Status,
+		Size:       e.Size,
+		Duration:   float64(e.Duration.Microseconds()) / 1000,
+	}
+}
+
+// Record adds the completed request to the current slot and sends it to the live streams
+func (a *Activity) Record(e *access.Entry) {
+	summary := summarize(e)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := a.slot(a.now().Unix())
+	s.requests++
+	if e.Status >= 500 {
+		s.errors++
+	}
+	s.latency[bucket(summary.Duration)]++
+
+	for stream := range a.streams {
+		select {
+		case stream <- summary:
+		default:
+		}
+	}
+}
+
+// slot returns the slot for the second, clearing it when it was last used for an older second
+func (a *Activity) slot(second int64) *slot {
+	s := &a.slots[second%historySeconds]
+	if s.second != second {
+		s.second = second
+		s.requests, s.errors = 0, 0
+		for i := range s.latency {
+			s.latency[i] = 0
+		}
+	}
+
+	return s
+}
+
+func bucket(milliseconds float64) int {
+	for i, bound := range latencyBounds {
+		if milliseconds <= bound {
+			return i
+		}
+	}
+	return len(latencyBounds)
+}
+
+// Windows returns the request statistics over each rolling window
+func (a *Activity) Windows() []Window {
+	now := a.now().Unix()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]Window, 0, len(windows))
+	for _, w := range windows {
+		seconds := int64(w.duration / time.Second)
+		latency := make([]uint64, len(latencyBounds)+1)
+
+		window := Window{Window: w.name}
+		for _, s := range a.slots {
+			if s.second <= now-seconds || s.second > now {
+				continue
+			}
+
+			window.Requests += s.requests
+			window.Errors += s.errors
+			for i, count := range s.latency {
+				latency[i] += count
+			}
+		}
+
+		window.Rate = float64(window.Requests) / float64(seconds)
+		if window.Requests > 0 {
+			window.ErrorRate = float64(window.Errors) / float64(window.Requests)
+			window.P50 = percentile(latency, window.Requests, 0.5)
+			window.P90 = percentile(latency, window.Requests, 0.9)
+			window.P99 = percentile(latency, window.Requests, 0.99)
+		}
+
+		result = append(result, window)
+	}
+
+	return result
+}
+
+// percentile estimates the latency percentile as the upper bound of the bucket it falls in
+func percentile(latency []uint64, total uint64, q float64) float64 {
+	rank := uint64(math.Ceil(q * float64(total)))
+
+	var seen uint64
+	for i, count := range latency {
+		seen += count
+		if seen >= rank && i < len(latencyBounds) {
+			return latencyBounds[i]
+		}
+	}
+
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// Subscribe returns a stream of the completed requests, the stream must be closed with the returned function
+//
+// A stream that falls behind misses summaries rather than slowing down the requests.
+func (a *Activity) Subscribe() (<-chan Summary, func()) {
+	stream := make(chan Summary, streamBuffer)
+
+	a.mu.Lock()
+	a.streams[stream] = struct{}{}
+	a.mu.Unlock()
+
+	return stream, func() {
+		a.mu.Lock()
+		delete(a.streams, stream)
+		a.mu.Unlock()
+	}
+}
@@ -0,0 +1,82 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+func TestActivityWindows(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	a := NewActivity()
+	a.now = func() time.Time { return now }
+
+	// 10 minutes ago, only in the 15m window
+	now = now.Add(-time.Minute * 10)
+	a.Record(&access.Entry{Status: 200, Duration: time.Second})
+
+	now = now.Add(time.Minute * 10)
+	for i := 0; i < 98; i++ {
+		a.Record(&access.Entry{Status: 200, Duration: time.Millisecond * 10})
+	}
+	a.Record(&access.Entry{Status: 502, Duration: time.Millisecond * 100})
+	a.Record(&access.Entry{Status: 500, Duration: time.Millisecond * 100})
+
+	windows := a.Windows()
+	if len(windows) != 3 {
+		t.Fatalf("expected 3 windows, got %d", len(windows))
+	}
+
+	minute := windows[0]
+	if minute.Window != "1m" || minute.Requests != 100 || minute.Errors != 2 {
+		t.Errorf("unexpected 1m window: %+v", minute)
+	}
+
+	if minute.ErrorRate != 0.02 {
+		t.Errorf("expected a 0.02 error rate, got %v", minute.ErrorRate)
+	}
+
+	if minute.P50 < 10 || minute.P50 > 15 {
+		t.Errorf("expected p50 close to 10ms, got %v", minute.P50)
+	}
+
+	if minute.P99 < 100 || minute.P99 > 150 {
+		t.Errorf("expected p99 close to 100ms, got %v", minute.P99)
+	}
+
+	if last := windows[2]; last.Requests != 101 || last.P99 < 100 {
+		t.Errorf("unexpected 15m window: %+v", last)
+	}
+
+	// the slots are reused once the history wraps around
+	now = now.Add(time.Minute * 15)
+	if windows := a.Windows(); windows[2].Requests != 0 {
+		t.Errorf("expected the history to have expired, got %+v", windows[2])
+	}
+}
+
+func TestActivitySubscribe(t *testing.T) {
+	a := NewActivity()
+
+	stream, unsubscribe := a.Subscribe()
+	a.Record(&access.Entry{Method: "GET", URI: "/index.html", Status: 200, Duration: time.Millisecond * 5})
+
+	select {
+	case summary := <-stream:
+		if summary.URI != "/index.html" || summary.Duration != 5 {
+			t.Errorf("unexpected summary: %+v", summary)
+		}
+	default:
+		t.Fatal("expected a summary on the stream")
+	}
+
+	unsubscribe()
+	a.Record(&access.Entry{Status: 200})
+
+	select {
+	case summary := <-stream:
+		t.Errorf("unexpected summary after unsubscribing: %+v", summary)
+	default:
+	}
+}
@@ -0,0 +1,117 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/renevo/gateway/config"
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/server"
+)
+
+// heartbeatInterval keeps idle streams from being closed by proxies between the dashboard and the gateway
+const heartbeatInterval = time.Second * 15
+
+// Gateway is the gateway state shown by the dashboard
+type Gateway interface {
+	Routes() []server.Route
+	Upstreams() []server.Upstream
+}
+
+// API registers the dashboard JSON API
+//
+//	/api/config     the running configuration, with the secrets redacted
+//	/api/routes     the mounted paths and their policies
+//	/api/upstreams  the state of the proxied backend services
+//	/api/stats      the request rates and latency percentiles over the rolling windows
+//	/api/stream     server sent events (request) for every completed request
+func (s *Server) API(cfg *config.Configuration, gateway Gateway, activity *Activity) {
+	s.Handle("/api/config", jsonHandler(func() (interface{}, error) {
+		data, err := cfg.Redacted().JSON()
+		return json.RawMessage(data), err
+	}))
+
+	s.Handle("/api/routes", jsonHandler(func() (interface{}, error) {
+		return gateway.Routes(), nil
+	}))
+
+	s.Handle("/api/upstreams", jsonHandler(func() (interface{}, error) {
+		return gateway.Upstreams(), nil
+	}))
+
+	s.Handle("/api/stats", jsonHandler(func() (interface{}, error) {
+		return struct {
+			Windows []Window `json:"windows"`
+		}{activity.Windows()}, nil
+	}))
+
+	s.Handle("/api/stream", s.stream(activity))
+}
+
+func jsonHandler(f func() (interface{}, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		v, err := f()
+		if err == nil {
+			var data []byte
+			if data, err = json.Marshal(v); err == nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "no-store")
+				w.Write(data)
+				return
+			}
+		}
+
+		logging.Errorf("Failed to serve monitoring %s: %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	})
+}
+
+// stream sends every completed request as a server sent event until the client disconnects or the monitoring server shuts down
+func (s *Server) stream(activity *Activity) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		summaries, unsubscribe := activity.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case summary := <-summaries:
+				data, err := json.Marshal(summary)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: request\ndata: %s\n\n", data)
+			case <-heartbeat.C:
+				io.WriteString(w, ": heartbeat\n\n")
+			case <-r.Context().Done():
+				return
+			case <-s.done:
+				return
+			}
+
+			flusher.Flush()
+		}
+	})
+}
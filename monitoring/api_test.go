@@ -0,0 +1,128 @@
+package monitoring
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/config"
+	"github.com/renevo/gateway/logging/access"
+	"github.com/renevo/gateway/server"
+)
+
+type gateway struct{}
+
+func (gateway) Routes() []server.Route {
+	return []server.Route{{Path: "/"}, {Path: "/api/", Backend: "http://localhost:5000"}}
+}
+
+func (gateway) Upstreams() []server.Upstream {
+	return []server.Upstream{{Path: "/api/", Backend: "http://localhost:5000", Up: true, State: "closed"}}
+}
+
+func TestAPI(t *testing.T) {
+	s := New("")
+	cfg := config.DefaultConfiguration()
+	cfg.Site.Discovery.Consul.Token = "secret-token"
+	s.API(cfg, gateway{}, NewActivity())
+
+	var routes []server.Route
+	get(t, s, "/api/routes", &routes)
+	if len(routes) != 2 || routes[1].Backend != "http://localhost:5000" {
+		t.Errorf("unexpected routes: %+v", routes)
+	}
+
+	var running map[string]interface{}
+	get(t, s, "/api/config", &running)
+	if _, ok := running["monitoring"].(map[string]interface{}); !ok {
+		t.Errorf("expected the configuration to use the yaml names, got %v", running)
+	}
+
+	if data, _ := json.Marshal(running); strings.Contains(string(data), "secret-token") {
+		t.Errorf("expected the consul token to be redacted, got %s", data)
+	}
+
+	var stats struct {
+		Windows []Window `json:"windows"`
+	}
+	get(t, s, "/api/stats", &stats)
+	if len(stats.Windows) != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("POST", "/api/routes", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func get(t *testing.T, h http.Handler, path string, v interface{}) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+	if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || ct != "application/json" {
+		t.Fatalf("%s: unexpected response %d %s", path, rec.Code, ct)
+	}
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: invalid json: %v", path, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	activity := NewActivity()
+	s := New("")
+	s.API(config.DefaultConfiguration(), gateway{}, activity)
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/api/stream")
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	// the stream is subscribed before the headers are sent
+	activity.Record(&access.Entry{Method: "GET", URI: "/", Status: 200})
+
+	lines := bufio.NewScanner(res.Body)
+	var event []string
+	for lines.Scan() && lines.Text() != "" {
+		event = append(event, lines.Text())
+	}
+
+	if len(event) != 2 || event[0] != "event: request" || !strings.Contains(event[1], `"status":200`) {
+		t.Errorf("unexpected event: %q", event)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for lines.Scan() {
+		}
+		close(done)
+	}()
+
+	s.Shutdown(ctx)
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Error("expected the stream to close on shutdown")
+	}
+}
@@ -0,0 +1,218 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// health check statuses
+const (
+	statusPass = "pass"
+	statusFail = "fail"
+)
+
+// Health reports the liveness and readiness of the gateway
+//
+// The gateway is live while the process can serve the monitoring site, and ready once every readiness check passes.
+type Health struct {
+	version string
+	started time.Time
+
+	mu     sync.Mutex
+	checks []check
+}
+
+type check struct {
+	name string
+	f    func() error
+}
+
+// report is the health check response body (application/health+json)
+type report struct {
+	Status  string                 `json:"status"`
+	Version string                 `json:"version,omitempty"`
+	Uptime  float64                `json:"uptime,omitempty"`
+	Checks  map[string]checkResult `json:"checks,omitempty"`
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+}
+
+// NewHealth creates the health reporter for the gateway version
+func NewHealth(version string) *Health {
+	return &Health{
+		version: version,
+		started: time.Now(),
+	}
+}
+
+// Check adds a readiness check, the check fails when f returns an error
+func (h *Health) Check(name string, f func() error) {
+	h.mu.Lock()
+	h.checks = append(h.checks, check{name: name, f: f})
+	h.mu.Unlock()
+}
+
+// Health registers the health check endpoints
+//
+//	/health/live                       200 while the gateway is running
+//	/health/ready                      200 when every readiness check passes, 503 otherwise
+//	/health/check                      same as /health/ready
+//	/health/check/specification.json   OpenAPI document for the endpoints
+//
+// Requests received through a proxy (with forwarding headers, e.g. the site proxying to the monitoring listener) only get the
+// status, the version, uptime and individual checks are only reported to direct requests.
+func (s *Server) Health(h *Health) {
+	s.Handle("/health/live", h.handler(false))
+	s.Handle("/health/ready", h.handler(true))
+	s.Handle("/health/check", h.handler(true))
+	s.Handle("/health/check/specification.json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(healthSpecification))
+	}))
+}
+
+func (h *Health) handler(readiness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		result := report{Status: statusPass}
+		if readiness {
+			result.Checks = h.run()
+			for _, c := range result.Checks {
+				if c.Status != statusPass {
+					result.Status = statusFail
+				}
+			}
+		}
+
+		if proxied(r) {
+			result.Checks = nil
+		} else {
+			result.Version = h.version
+			result.Uptime = time.Since(h.started).Truncate(time.Second).Seconds()
+		}
+
+		code := http.StatusOK
+		if result.Status != statusPass {
+			code = http.StatusServiceUnavailable
+		}
+
+		data, _ := json.Marshal(result)
+
+		w.Header().Set("Content-Type", "application/health+json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		w.Write(data)
+	})
+}
+
+func (h *Health) run() map[string]checkResult {
+	h.mu.Lock()
+	checks := h.checks
+	h.mu.Unlock()
+
+	results := make(map[string]checkResult, len(checks))
+	for _, c := range checks {
+		if err := c.f(); err != nil {
+			results[c.name] = checkResult{Status: statusFail, Output: err.Error()}
+		} else {
+			results[c.name] = checkResult{Status: statusPass}
+		}
+	}
+
+	return results
+}
+
+// proxied returns true when the request was forwarded by a proxy
+func proxied(r *http.Request) bool {
+	return r.Header.Get("Forwarded") != "" || r.Header.Get("X-Forwarded-For") != ""
+}
+
+const healthSpecification = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Gateway Health",
+    "description": "Liveness and readiness of the gateway. Requests received through a proxy only get the status.",
+    "version": "1.0.0"
+  },
+  "paths": {
+    "/health/live": {
+      "get": {
+        "summary": "Liveness",
+        "operationId": "live",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Health"}
+        }
+      }
+    },
+    "/health/ready": {
+      "get": {
+        "summary": "Readiness",
+        "operationId": "ready",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Health"},
+          "503": {"$ref": "#/components/responses/Health"}
+        }
+      }
+    },
+    "/health/check": {
+      "get": {
+        "summary": "Readiness",
+        "operationId": "check",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Health"},
+          "503": {"$ref": "#/components/responses/Health"}
+        }
+      }
+    }
+  },
+  "components": {
+    "responses": {
+      "Health": {
+        "description": "Health report",
+        "content": {
+          "application/health+json": {
+            "schema": {"$ref": "#/components/schemas/Health"}
+          }
+        }
+      }
+    },
+    "schemas": {
+      "Status": {
+        "type": "string",
+        "enum": ["pass", "fail"]
+      },
+      "Health": {
+        "type": "object",
+        "required": ["status"],
+        "properties": {
+          "status": {"$ref": "#/components/schemas/Status"},
+          "version": {"type": "string", "description": "Only reported to direct requests"},
+          "uptime": {"type": "number", "description": "Seconds since the gateway started, only reported to direct requests"},
+          "checks": {
+            "type": "object",
+            "description": "Readiness checks by name, only reported to direct requests: listeners (every listener is bound), content (the site content is loaded) and discovery (the discovered services are synced)",
+            "additionalProperties": {
+              "type": "object",
+              "required": ["status"],
+              "properties": {
+                "status": {"$ref": "#/components/schemas/Status"},
+                "output": {"type": "string", "description": "Why the check failed"}
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,79 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	ready := errors.New("1 of 2 listeners bound")
+
+	h := NewHealth("1.0.0")
+	h.Check("listeners", func() error { return ready })
+	h.Check("content", func() error { return nil })
+
+	s := New("")
+	s.Health(h)
+
+	tests := []struct {
+		name    string
+		path    string
+		proxied bool
+		ready   error
+		code    int
+		status  string
+		checks  int
+	}{
+		{"live", "/health/live", false, ready, http.StatusOK, "pass", 0},
+		{"not ready", "/health/ready", false, ready, http.StatusServiceUnavailable, "fail", 2},
+		{"ready", "/health/check", false, nil, http.StatusOK, "pass", 2},
+		{"proxied", "/health/check", true, ready, http.StatusServiceUnavailable, "fail", 0},
+	}
+
+	for _, tt := range tests {
+		ready = tt.ready
+
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.proxied {
+			r.Header.Set("X-Forwarded-For", "203.0.113.10")
+		}
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, r)
+
+		if rec.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.code, rec.Code)
+		}
+
+		if ct := rec.Header().Get("Content-Type"); ct != "application/health+json" {
+			t.Errorf("%s: unexpected content type %q", tt.name, ct)
+		}
+
+		var result report
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("%s: invalid json: %v", tt.name, err)
+		}
+
+		if result.Status != tt.status || len(result.Checks) != tt.checks {
+			t.Errorf("%s: unexpected report %+v", tt.name, result)
+		}
+
+		if version := result.Version != ""; version == tt.proxied {
+			t.Errorf("%s: expected the version only for direct requests, got %+v", tt.name, result)
+		}
+	}
+}
+
+func TestHealthSpecification(t *testing.T) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal([]byte(healthSpecification), &spec); err != nil {
+		t.Fatalf("invalid specification: %v", err)
+	}
+
+	if paths, _ := spec["paths"].(map[string]interface{}); len(paths) != 3 {
+		t.Errorf("expected 3 paths, got %v", paths)
+	}
+}
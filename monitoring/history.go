@@ -0,0 +1,210 @@
+package monitoring
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+const (
+	defaultHistorySize    = 1000
+	defaultHistorySlowest = 10
+	defaultHistoryWindow  = time.Minute * 5
+)
+
+// History keeps the most recent requests and the slowest requests of each route, it is a metrics recorder
+//
+// Memory is constant: the recent requests are a ring buffer, and each route (a mounted path, so there are a fixed number) keeps
+// at most the configured number of slow requests. Slow requests older than the window are dropped as new requests arrive, so
+// the slowest requests reported are the slowest seen that are still within the window.
+type History struct {
+	slowest int
+	window  time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	recent []Summary
+	next   int
+	full   bool
+	slow   map[string][]Summary
+}
+
+// NewHistory creates the history, keeping size recent requests and the slowest requests per route within the window
+func NewHistory(size, slowest int, window time.Duration) *History {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+
+	if slowest <= 0 {
+		slowest = defaultHistorySlowest
+	}
+
+	if window <= 0 {
+		window = defaultHistoryWindow
+	}
+
+	return &History{
+		slowest: slowest,
+		window:  window,
+		now:     time.Now,
+		recent:  make([]Summary, size),
+		slow:    make(map[string][]Summary),
+	}
+}
+
+// Record adds the completed request to the recent requests, and to the slowest requests of its route when it is slow enough
+func (h *History) Record(e *access.Entry) {
+	summary := summarize(e)
+	cutoff := h.now().Add(-h.window)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.recent[h.next] = summary
+	h.next = (h.next + 1) % len(h.recent)
+	if h.next == 0 {
+		h.full = true
+	}
+
+	// drop the expired requests, keeping the rest in place
+	slow := h.slow[e.Route][:0]
+	for _, s := range h.slow[e.Route] {
+		if s.Time.After(cutoff) {
+			slow = append(slow, s)
+		}
+	}
+
+	if len(slow) < h.slowest {
+		slow = append(slow, summary)
+	} else {
+		fastest := 0
+		for i := range slow {
+			if slow[i].Duration < slow[fastest].Duration {
+				fastest = i
+			}
+		}
+
+		if summary.Duration > slow[fastest].Duration {
+			slow[fastest] = summary
+		}
+	}
+
+	h.slow[e.Route] = slow
+}
+
+// Filter selects requests from the history
+type Filter struct {
+	// Class is the status class (2 for 2xx), zero for any status
+	Class int
+	// Route is the mounted path that served the request, empty for any route
+	Route string
+	// Limit is the maximum number of requests, zero for no limit
+	Limit int
+}
+
+func (f Filter) match(s Summary) bool {
+	if f.Class != 0 && s.Status/100 != f.Class {
+		return false
+	}
+
+	return f.Route == "" || s.Route == f.Route
+}
+
+// Recent returns the recent requests matching the filter, newest first
+func (h *History) Recent(f Filter) []Summary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.recent)
+	}
+
+	result := []Summary{}
+	for i := 1; i <= count && (f.Limit <= 0 || len(result) < f.Limit); i++ {
+		s := h.recent[(h.next-i+len(h.recent))%len(h.recent)]
+		if f.match(s) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// Slowest returns the slowest requests within the window matching the filter, slowest first
+func (h *History) Slowest(f Filter) []Summary {
+	cutoff := h.now().Add(-h.window)
+
+	h.mu.Lock()
+	result := []Summary{}
+	for _, slow := range h.slow {
+		for _, s := range slow {
+			if s.Time.After(cutoff) && f.match(s) {
+				result = append(result, s)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Duration > result[j].Duration
+	})
+
+	if f.Limit > 0 && len(result) > f.Limit {
+		result = result[:f.Limit]
+	}
+
+	return result
+}
+
+// History registers the request history endpoints
+//
+//	/api/requests          the recent requests, newest first
+//	/api/requests/slowest  the slowest requests of each route within the window, slowest first
+//
+// Both accept the status (a class, e.g. 5xx), route (a mounted path, e.g. /api), and limit query parameters.
+func (s *Server) History(h *History) {
+	s.Handle("/api/requests", historyHandler(h.Recent))
+	s.Handle("/api/requests/slowest", historyHandler(h.Slowest))
+}
+
+func historyHandler(query func(Filter) []Summary) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		jsonHandler(func() (interface{}, error) {
+			return query(f), nil
+		}).ServeHTTP(w, r)
+	})
+}
+
+func parseFilter(r *http.Request) (Filter, error) {
+	q := r.URL.Query()
+	f := Filter{Route: q.Get("route")}
+
+	if status := q.Get("status"); status != "" {
+		if len(status) != 3 || status[1:] != "xx" || status[0] < '1' || status[0] > '5' {
+			return f, fmt.Errorf("invalid status %q, expected a status class (e.g. 5xx)", status)
+		}
+		f.Class = int(status[0] - '0')
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("invalid limit %q", limit)
+		}
+		f.Limit = n
+	}
+
+	return f, nil
+}
@@ -0,0 +1,89 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/logging/access"
+)
+
+func TestHistoryRecent(t *testing.T) {
+	h := NewHistory(3, 0, 0)
+
+	for i, status := range []int{200, 404, 500, 200, 502} {
+		h.Record(&access.Entry{Status: status, Route: "/api", Size: int64(i)})
+	}
+
+	recent := h.Recent(Filter{})
+	if len(recent) != 3 || recent[0].Size != 4 || recent[2].Size != 2 {
+		t.Errorf("expected the 3 newest requests newest first, got %+v", recent)
+	}
+
+	if errors := h.Recent(Filter{Class: 5}); len(errors) != 2 || errors[0].Status != 502 {
+		t.Errorf("unexpected 5xx requests: %+v", errors)
+	}
+
+	if limited := h.Recent(Filter{Limit: 1}); len(limited) != 1 {
+		t.Errorf("expected 1 request, got %d", len(limited))
+	}
+
+	if other := h.Recent(Filter{Route: "/"}); len(other) != 0 {
+		t.Errorf("unexpected requests for the site root: %+v", other)
+	}
+}
+
+func TestHistorySlowest(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	h := NewHistory(10, 2, time.Minute)
+	h.now = func() time.Time { return now }
+
+	record := func(route string, d time.Duration) {
+		h.Record(&access.Entry{Time: now, Status: 200, Route: route, Duration: d})
+	}
+
+	record("/api", time.Second*10)
+	now = now.Add(time.Minute)
+
+	record("/api", time.Millisecond*10)
+	record("/api", time.Millisecond*30)
+	record("/api", time.Millisecond*20)
+	record("/", time.Millisecond*5)
+
+	slowest := h.Slowest(Filter{Route: "/api"})
+	if len(slowest) != 2 || slowest[0].Duration != 30 || slowest[1].Duration != 20 {
+		t.Errorf("expected the 2 slowest requests within the window, got %+v", slowest)
+	}
+
+	if all := h.Slowest(Filter{}); len(all) != 3 {
+		t.Errorf("expected the slowest requests of every route, got %+v", all)
+	}
+}
+
+func TestHistoryAPI(t *testing.T) {
+	h := NewHistory(10, 0, 0)
+	h.Record(&access.Entry{Status: 503, Route: "/api", Upstream: "http://localhost:5000"})
+
+	s := New("")
+	s.History(h)
+
+	var requests []Summary
+	get(t, s, "/api/requests?status=5xx&route=/api", &requests)
+	if len(requests) != 1 || requests[0].Upstream != "http://localhost:5000" {
+		t.Errorf("unexpected requests: %+v", requests)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/requests/slowest?status=500", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected %d for an invalid status class, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/requests/slowest?status=2xx", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &requests); err != nil || len(requests) != 0 {
+		t.Errorf("expected no slow 2xx requests, got %s", rec.Body)
+	}
+}
@@ -0,0 +1,112 @@
+package monitoring
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+)
+
+const (
+	readHeaderTimeout = time.Second * 10
+	idleTimeout       = time.Minute * 2
+)
+
+// Server is the monitoring website, serving the monitoring front end and the endpoints registered with Handle
+type Server struct {
+	mux  *http.ServeMux
+	done chan struct{}
+
+	mu     sync.Mutex
+	inner  *http.Server
+	closed bool
+}
+
+// New creates the monitoring server, the front end is served from the content path
+func New(path string) *Server {
+	s := &Server{
+		mux:  http.NewServeMux(),
+		done: make(chan struct{}),
+	}
+
+	if path != "" {
+		s.mux.Handle("/", http.FileServer(http.Dir(path)))
+	}
+
+	return s
+}
+
+// Handle registers the handler for the pattern, replacing the front end for those paths
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+// ServeHTTP serves a monitoring request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Listen serves the monitoring site on the address, over https when a certificate and key are provided
+func (s *Server) Listen(addr *url.URL, cert, key string) error {
+	network := addr.Scheme
+	if network == "" {
+		network = "tcp"
+	}
+
+	port := addr.Port()
+	if port == "" {
+		port = "80"
+		if cert != "" {
+			port = "443"
+		}
+	}
+
+	ln, err := net.Listen(network, addr.Hostname()+":"+port)
+	if err != nil {
+		return err
+	}
+
+	inner := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return http.ErrServerClosed
+	}
+	s.inner = inner
+	s.mu.Unlock()
+
+	if cert != "" {
+		logging.Infof("Serving monitoring on https://%s", ln.Addr())
+		return inner.ServeTLS(ln, cert, key)
+	}
+
+	logging.Infof("Serving monitoring on http://%s", ln.Addr())
+	return inner.Serve(ln)
+}
+
+// Shutdown gracefully stops the monitoring listener, live streams are closed straight away
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	inner := s.inner
+	s.mu.Unlock()
+
+	if inner == nil {
+		return nil
+	}
+
+	return inner.Shutdown(ctx)
+}
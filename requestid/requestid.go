@@ -0,0 +1,45 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"regexp"
+)
+
+// Header is the request and response header carrying the request id
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// incoming request ids are only accepted when they are reasonably sized and safe to log
+var valid = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]{1,128}$`)
+
+// New generates a random (version 4) UUID
+func New() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(fmt.Errorf("failed to generate request id: %v", err))
+	}
+
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// Valid returns true when an incoming request id can be used as is
+func Valid(id string) bool {
+	return valid.MatchString(id)
+}
+
+// NewContext returns a context carrying the request id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id of the context, or an empty string
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,40 @@
+package requestid
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	uuid4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	id := New()
+	if !uuid4.MatchString(id) {
+		t.Errorf("expected a uuid4, got %q", id)
+	}
+
+	if New() == id {
+		t.Errorf("expected request ids to be unique")
+	}
+
+	if FromContext(NewContext(context.Background(), id)) != id {
+		t.Errorf("expected request id to round trip through the context")
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := map[string]bool{
+		"f47ac10b-58cc-4372-a567-0e02b2c3d479": true,
+		"Root=1-67891233-abcdef012345678912":   true,
+		"":                                     false,
+		"has space":                            false,
+		"new\nline":                            false,
+	}
+
+	for id, expected := range tests {
+		if Valid(id) != expected {
+			t.Errorf("Valid(%q) expected %v", id, expected)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/renevo/gateway/logging"
+)
+
+// Options defines a cross origin resource sharing policy
+type Options struct {
+	// Disable will decline all cross origin requests
+	Disable bool `json:"disable"`
+	// Handle will have the gateway answer preflight requests and validate cross origin requests instead of the backends
+	Handle bool `json:"handle"`
+	// Origins that are allowed: *, exact origins, wildcards (https://*.example.org), or regular expressions (/^https://.*$/)
+	Origins []string `json:"origins"`
+	// Methods that are allowed, * for all
+	Methods []string `json:"methods"`
+	// RequestHeaders that the client may send, * for all
+	RequestHeaders []string `json:"request_headers"`
+	// ResponseHeaders that the client may read, * for all
+	ResponseHeaders []string `json:"response_headers"`
+	// AllowCredentials allows cookies and authentication headers to be sent
+	AllowCredentials bool `json:"authentication"`
+}
+
+// ErrorHandler writes a gateway generated error response to the client
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, code int)
+
+// Policy is a compiled cross origin resource sharing policy
+type Policy struct {
+	options        Options
+	anyOrigin      bool
+	origins        []*regexp.Regexp
+	anyMethod      bool
+	methods        []string
+	anyHeader      bool
+	requestHeaders map[string]bool
+	exposeAll      bool
+	exposeHeaders  []string
+}
+
+// simple methods never need to be listed in the allowed methods
+var simpleMethods = map[string]bool{
+	http.MethodGet:  true,
+	http.MethodHead: true,
+	http.MethodPost: true,
+}
+
+// New compiles the options into a policy
+//
+// Allowing all origins together with credentials is refused, browsers will not accept it and reflecting every origin
+// would allow any site to make authenticated requests.
+func New(options Options) (*Policy, error) {
+	p := &Policy{
+		options:        options,
+		requestHeaders: make(map[string]bool),
+	}
+
+	for _, origin := range options.Origins {
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+
+		matcher, err := compileOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+		p.origins = append(p.origins, matcher)
+	}
+
+	if p.anyOrigin && options.AllowCredentials {
+		return nil, errors.New("cors origins * can not be combined with authentication, list the allowed origins instead")
+	}
+
+	for _, method := range options.Methods {
+		if method == "*" {
+			p.anyMethod = true
+			continue
+		}
+		p.methods = append(p.methods, strings.ToUpper(method))
+	}
+
+	for _, header := range options.RequestHeaders {
+		if header == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.requestHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	if options.AllowCredentials {
+		p.requestHeaders["Authorization"] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, header := range options.ResponseHeaders {
+		if header == "*" {
+			p.exposeAll = true
+			continue
+		}
+
+		header = http.CanonicalHeaderKey(header)
+		if !seen[header] {
+			seen[header] = true
+			p.exposeHeaders = append(p.exposeHeaders, header)
+		}
+	}
+
+	return p, nil
+}
+
+func compileOrigin(origin string) (*regexp.Regexp, error) {
+	if len(origin) > 2 && strings.HasPrefix(origin, "/") && strings.HasSuffix(origin, "/") {
+		matcher, err := regexp.Compile(origin[1 : len(origin)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cors origin expression %q: %v", origin, err)
+		}
+		return matcher, nil
+	}
+
+	pattern := regexp.QuoteMeta(strings.ToLower(strings.TrimSuffix(origin, "/")))
+	pattern = strings.Replace(pattern, `\*`, `[^/]*`, -1)
+
+	return regexp.Compile("^" + pattern + "$")
+}
+
+// Options returns the options the policy was created with
+func (p *Policy) Options() Options {
+	return p.options
+}
+
+// AllowsOrigin returns true when the origin is allowed by the policy
+func (p *Policy) AllowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, matcher := range p.origins {
+		if matcher.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) allowsMethod(method string) bool {
+	if p.anyMethod || simpleMethods[method] {
+		return true
+	}
+
+	for _, m := range p.methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) allowsHeaders(headers []string) bool {
+	if p.anyHeader {
+		return true
+	}
+
+	for _, header := range headers {
+		if !p.requestHeaders[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Handler applies the policy to all cross origin requests for next
+func (p *Policy) Handler(next http.Handler, deny ErrorHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		if sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if p.options.Disable {
+			logging.FromContext(r.Context()).Debugf("CORS: declined %s %s from %q, cross origin requests are disabled", r.Method, r.URL, origin)
+			deny(w, r, http.StatusForbidden)
+			return
+		}
+
+		if !p.options.Handle {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !p.AllowsOrigin(origin) {
+			logging.FromContext(r.Context()).Debugf("CORS: declined %s %s from %q, origin not allowed", r.Method, r.URL, origin)
+			deny(w, r, http.StatusForbidden)
+			return
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			p.preflight(w, r, origin, deny)
+			return
+		}
+
+		if !p.allowsMethod(r.Method) {
+			logging.FromContext(r.Context()).Debugf("CORS: declined %s %s from %q, method not allowed", r.Method, r.URL, origin)
+			deny(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(&responseWriter{ResponseWriter: w, policy: p, origin: origin}, r)
+	})
+}
+
+func (p *Policy) preflight(w http.ResponseWriter, r *http.Request, origin string, deny ErrorHandler) {
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	headers := splitHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	if !p.allowsMethod(method) || !p.allowsHeaders(headers) {
+		logging.FromContext(r.Context()).Debugf("CORS: declined preflight %s %s from %q with headers %v", method, r.URL, origin, headers)
+		deny(w, r, http.StatusForbidden)
+		return
+	}
+
+	p.allowOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", method)
+
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Policy) allowOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if p.options.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// decorate writes the CORS response headers, replacing any that the backend sent
+func (p *Policy) decorate(h http.Header, origin string) {
+	for key := range h {
+		if strings.HasPrefix(key, "Access-Control-") {
+			h.Del(key)
+		}
+	}
+
+	p.allowOrigin(h, origin)
+
+	exposed := p.exposeHeaders
+	if p.exposeAll {
+		if !p.options.AllowCredentials {
+			h.Set("Access-Control-Expose-Headers", "*")
+			return
+		}
+
+		// with credentials * is not a wildcard, so list everything in the response
+		exposed = nil
+		for key := range h {
+			if !safelisted[key] && !strings.HasPrefix(key, "Access-Control-") {
+				exposed = append(exposed, key)
+			}
+		}
+		sort.Strings(exposed)
+	}
+
+	if len(exposed) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+	}
+}
+
+// safelisted response headers are always readable by the client
+var safelisted = map[string]bool{
+	"Cache-Control":    true,
+	"Content-Language": true,
+	"Content-Length":   true,
+	"Content-Type":     true,
+	"Expires":          true,
+	"Last-Modified":    true,
+	"Pragma":           true,
+}
+
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func splitHeaderList(value string) []string {
+	var headers []string
+	for _, header := range strings.Split(value, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+
+	return headers
+}
+
+// responseWriter decorates the response with the CORS headers once the backend has written its own
+type responseWriter struct {
+	http.ResponseWriter
+	policy      *Policy
+	origin      string
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= http.StatusOK {
+		w.wroteHeader = true
+		w.policy.decorate(w.Header(), w.origin)
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
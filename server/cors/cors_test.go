@@ -0,0 +1,130 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func deny(w http.ResponseWriter, r *http.Request, code int) {
+	http.Error(w, http.StatusText(code), code)
+}
+
+var backend = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-Custom-Header", "RAWR")
+	w.Write([]byte("ok"))
+})
+
+func serve(t *testing.T, options Options, r *http.Request) *httptest.ResponseRecorder {
+	policy, err := New(options)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	policy.Handler(backend, deny).ServeHTTP(w, r)
+	return w
+}
+
+func TestPreflightAnsweredByGateway(t *testing.T) {
+	r := httptest.NewRequest(http.MethodOptions, "http://api.example.org/api/test", nil)
+	r.Header.Set("Origin", "https://www.example.org")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	r.Header.Set("Access-Control-Request-Headers", "x-custom-header, authorization")
+
+	w := serve(t, Options{
+		Handle:           true,
+		Origins:          []string{"https://*.example.org"},
+		Methods:          []string{"PUT"},
+		RequestHeaders:   []string{"X-CUSTOM-HEADER"},
+		AllowCredentials: true,
+	}, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 preflight response, got %d", w.Code)
+	}
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":      "https://www.example.org",
+		"Access-Control-Allow-Methods":     "PUT",
+		"Access-Control-Allow-Headers":     "x-custom-header, authorization",
+		"Access-Control-Allow-Credentials": "true",
+	}
+
+	for header, value := range expected {
+		if actual := w.Header().Get(header); actual != value {
+			t.Errorf("expected %s: %q, got %q", header, value, actual)
+		}
+	}
+}
+
+func TestPreflightDeclined(t *testing.T) {
+	tests := map[string]func(r *http.Request){
+		"origin": func(r *http.Request) { r.Header.Set("Origin", "https://evil.org") },
+		"method": func(r *http.Request) { r.Header.Set("Access-Control-Request-Method", "DELETE") },
+		"header": func(r *http.Request) { r.Header.Set("Access-Control-Request-Headers", "X-Other") },
+	}
+
+	for name, modify := range tests {
+		r := httptest.NewRequest(http.MethodOptions, "http://api.example.org/", nil)
+		r.Header.Set("Origin", "https://example.org")
+		r.Header.Set("Access-Control-Request-Method", "PUT")
+		modify(r)
+
+		w := serve(t, Options{
+			Handle:  true,
+			Origins: []string{"https://example.org", "/^https://[a-z]+\\.example\\.org$/"},
+			Methods: []string{"PUT"},
+		}, r)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestSimpleRequestDecorated(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.org/", nil)
+	r.Header.Set("Origin", "https://app.example.org")
+
+	w := serve(t, Options{
+		Handle:           true,
+		Origins:          []string{"/^https://[a-z]+\\.example\\.org$/"},
+		ResponseHeaders:  []string{"*"},
+		AllowCredentials: true,
+	}, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://app.example.org" {
+		t.Errorf("expected the backend allow origin to be replaced, got %q", origin)
+	}
+
+	if exposed := w.Header().Get("Access-Control-Expose-Headers"); exposed != "Vary, X-Custom-Header" {
+		t.Errorf("expected response headers to be listed when using credentials, got %q", exposed)
+	}
+}
+
+func TestDisabledDeclinesCrossOrigin(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://example.org/", nil)
+	r.Header.Set("Origin", "https://other.org")
+
+	if w := serve(t, Options{Disable: true}, r); w.Code != http.StatusForbidden {
+		t.Errorf("expected cross origin request to be declined, got %d", w.Code)
+	}
+
+	r.Header.Set("Origin", "https://example.org")
+
+	if w := serve(t, Options{Disable: true}, r); w.Code != http.StatusOK {
+		t.Errorf("expected same origin request to be allowed, got %d", w.Code)
+	}
+}
+
+func TestWildcardWithCredentialsRefused(t *testing.T) {
+	if _, err := New(Options{Origins: []string{"*"}, AllowCredentials: true}); err == nil {
+		t.Errorf("expected * origins with credentials to be refused")
+	}
+}
@@ -0,0 +1,186 @@
+package headers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/renevo/gateway/requestid"
+)
+
+// Options defines the response header policy
+type Options struct {
+	// Server is the value of the Server header, when empty no Server header is sent
+	Server string
+	// Strip removes the headers from every response before it is sent to the client
+	Strip []string
+	// Append adds the headers to every response, replacing the value sent by the backend
+	Append map[string]string
+	// RequestID returns the id of the request in the X-Request-ID header
+	RequestID bool
+	// Debug adds X-Remote-URL, X-Content-Path, and X-Content-Last-Modified to responses
+	Debug bool
+}
+
+// Policy is the response header policy applied to every response
+type Policy struct {
+	server       string
+	strip        []string
+	appendKeys   []string
+	appendValues map[string]string
+	requestID    bool
+	debug        bool
+}
+
+type debugKey struct{}
+
+// debugInfo is filled in by the handler serving the request when debug headers are enabled
+type debugInfo struct {
+	remoteURL    string
+	contentPath  string
+	lastModified time.Time
+}
+
+// New creates the response header policy
+func New(options Options) *Policy {
+	p := &Policy{
+		server:       options.Server,
+		appendValues: make(map[string]string, len(options.Append)),
+		requestID:    options.RequestID,
+		debug:        options.Debug,
+	}
+
+	for _, header := range options.Strip {
+		p.strip = append(p.strip, http.CanonicalHeaderKey(header))
+	}
+
+	for header, value := range options.Append {
+		header = http.CanonicalHeaderKey(header)
+		p.appendKeys = append(p.appendKeys, header)
+		p.appendValues[header] = value
+	}
+	sort.Strings(p.appendKeys)
+
+	return p
+}
+
+// Debugging returns true when the debug headers will be sent for the request
+func Debugging(ctx context.Context) bool {
+	_, ok := ctx.Value(debugKey{}).(*debugInfo)
+	return ok
+}
+
+// SetRemoteURL records the backend URL that served the request for the X-Remote-URL debug header
+func SetRemoteURL(ctx context.Context, remoteURL string) {
+	if info, ok := ctx.Value(debugKey{}).(*debugInfo); ok {
+		info.remoteURL = remoteURL
+	}
+}
+
+// SetContent records the file on disk that served the request for the X-Content-* debug headers
+func SetContent(ctx context.Context, path string, modified time.Time) {
+	if info, ok := ctx.Value(debugKey{}).(*debugInfo); ok {
+		info.contentPath = path
+		info.lastModified = modified
+	}
+}
+
+// Handler applies the policy to all responses from next
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w, policy: p}
+
+		if p.requestID {
+			rw.requestID = requestid.FromContext(r.Context())
+		}
+
+		if p.debug {
+			rw.debug = &debugInfo{}
+			r = r.WithContext(context.WithValue(r.Context(), debugKey{}, rw.debug))
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// apply strips the blacklisted headers from the response, then adds the gateway headers
+func (p *Policy) apply(h http.Header, requestID string, debug *debugInfo) {
+	for _, header := range p.strip {
+		h.Del(header)
+	}
+
+	if p.server != "" {
+		h.Set("Server", p.server)
+	}
+
+	for _, header := range p.appendKeys {
+		h.Set(header, p.appendValues[header])
+	}
+
+	if requestID != "" {
+		h.Set(requestid.Header, requestID)
+	}
+
+	if debug == nil {
+		return
+	}
+
+	if debug.remoteURL != "" {
+		h.Set("X-Remote-URL", debug.remoteURL)
+	}
+
+	if debug.contentPath != "" {
+		h.Set("X-Content-Path", debug.contentPath)
+		h.Set("X-Content-Last-Modified", debug.lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// responseWriter applies the header policy right before the response headers are written
+type responseWriter struct {
+	http.ResponseWriter
+	policy      *Policy
+	requestID   string
+	debug       *debugInfo
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= http.StatusOK {
+		w.wroteHeader = true
+		w.policy.apply(w.Header(), w.requestID, w.debug)
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// ReadFrom keeps sendfile available to the underlying connection when serving files
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,89 @@
+package headers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/requestid"
+)
+
+func TestPolicyStripsThenAppends(t *testing.T) {
+	modified := time.Date(2017, 10, 10, 12, 0, 0, 0, time.UTC)
+
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRemoteURL(r.Context(), "http://127.0.0.1:8000/test")
+		SetContent(r.Context(), "/var/www/index.html", modified)
+
+		w.Header().Set("Server", "nginx")
+		w.Header().Set("X-Remote-Tracking", "secret")
+		w.Header().Set("X-Backend", "kept")
+		w.Header().Set("X-Request-ID", "from-backend")
+		w.Write([]byte("ok"))
+	})
+
+	policy := New(Options{
+		Server:    "gateway/1.0.0",
+		Strip:     []string{"server", "x-remote-tracking", "X-Remote-URL", "X-Request-ID"},
+		Append:    map[string]string{"x-custom-header": "RAWR"},
+		RequestID: true,
+		Debug:     true,
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), "abc-123"))
+
+	w := httptest.NewRecorder()
+	policy.Handler(backend).ServeHTTP(w, r)
+
+	expected := map[string]string{
+		"Server":                  "gateway/1.0.0",
+		"X-Remote-Tracking":       "",
+		"X-Backend":               "kept",
+		"X-Custom-Header":         "RAWR",
+		"X-Request-Id":            "abc-123",
+		"X-Remote-Url":            "http://127.0.0.1:8000/test",
+		"X-Content-Path":          "/var/www/index.html",
+		"X-Content-Last-Modified": "Tue, 10 Oct 2017 12:00:00 GMT",
+	}
+
+	for header, value := range expected {
+		if actual := w.Header().Get(header); actual != value {
+			t.Errorf("expected %s: %q, got %q", header, value, actual)
+		}
+	}
+}
+
+func TestPolicyAppendReplacesBackendHeader(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("ok"))
+	})
+
+	policy := New(Options{Append: map[string]string{"cache-control": "no-store"}})
+
+	w := httptest.NewRecorder()
+	policy.Handler(backend).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if values := w.Header().Values("Cache-Control"); len(values) != 1 || values[0] != "no-store" {
+		t.Errorf("expected only the configured Cache-Control, got %q", values)
+	}
+}
+
+func TestPolicyWithoutDebug(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Debugging(r.Context()) {
+			t.Errorf("expected debugging to be disabled")
+		}
+		SetRemoteURL(r.Context(), "http://127.0.0.1:8000/test")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	New(Options{}).Handler(backend).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Header().Get("X-Remote-URL") != "" || w.Header().Get("Server") != "" {
+		t.Errorf("unexpected headers: %v", w.Header())
+	}
+}
@@ -0,0 +1,326 @@
+package openapi
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// component sections that can be referenced with #/components/<section>/<name>
+var sections = []string{"schemas", "responses", "parameters", "examples", "requestBodies", "headers", "securitySchemes", "links", "callbacks"}
+
+// methods are the operations of a path item
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// fetched is the specification of a single service, or the error fetching it
+type fetched struct {
+	source Source
+	doc    map[string]interface{}
+	err    error
+}
+
+// SpecError is a service specification that could not be merged
+type SpecError struct {
+	Service string `json:"service" yaml:"service"`
+	Spec    string `json:"spec" yaml:"spec"`
+	Error   string `json:"error" yaml:"error"`
+}
+
+// merge combines the service specifications into a single document, with the paths rewritten to the routed paths
+//
+// Components are shared when every service defines them the same way, when they differ each service's component is namespaced
+// with the service path (api_test_Pet for /api/test). A path provided by more than one service is kept from the first service.
+func merge(version string, specs []fetched) (map[string]interface{}, []SpecError) {
+	var errs []SpecError
+	fail := func(f fetched, err error) {
+		errs = append(errs, SpecError{Service: f.source.Path, Spec: f.source.Spec, Error: err.Error()})
+	}
+
+	var valid []fetched
+	for _, f := range specs {
+		if f.err != nil {
+			fail(f, f.err)
+			continue
+		}
+
+		if v, _ := f.doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+			fail(f, fmt.Errorf("not an OpenAPI 3 specification"))
+			continue
+		}
+
+		valid = append(valid, f)
+	}
+
+	renames := namespaceCollisions(valid)
+
+	paths := map[string]interface{}{}
+	components := map[string]interface{}{}
+	tags := map[string]interface{}{}
+
+	for i, f := range valid {
+		doc := rewriteRefs(f.doc, renames[i]).(map[string]interface{})
+
+		for _, section := range sections {
+			defined, _ := lookup(doc, "components", section).(map[string]interface{})
+			for name, value := range defined {
+				merged, _ := components[section].(map[string]interface{})
+				if merged == nil {
+					merged = map[string]interface{}{}
+					components[section] = merged
+				}
+
+				if renamed, ok := renames[i][ref(section, name)]; ok {
+					name = strings.TrimPrefix(renamed, "#/components/"+section+"/")
+				}
+				merged[name] = value
+			}
+		}
+
+		security, hasSecurity := doc["security"]
+		base := basePath(doc)
+
+		items, _ := doc["paths"].(map[string]interface{})
+		for _, p := range sortedKeys(items) {
+			routed, ok := route(f.source, joinPath(base, p))
+			if !ok {
+				continue
+			}
+
+			if _, exists := paths[routed]; exists {
+				fail(f, fmt.Errorf("path %s is already provided by another service", routed))
+				continue
+			}
+
+			item, _ := items[p].(map[string]interface{})
+			if hasSecurity {
+				for _, method := range methods {
+					if op, ok := item[method].(map[string]interface{}); ok {
+						if _, ok := op["security"]; !ok {
+							op["security"] = security
+						}
+					}
+				}
+			}
+
+			paths[routed] = item
+		}
+
+		list, _ := doc["tags"].([]interface{})
+		for _, t := range list {
+			if tag, ok := t.(map[string]interface{}); ok {
+				if name, ok := tag["name"].(string); ok {
+					if _, exists := tags[name]; !exists {
+						tags[name] = tag
+					}
+				}
+			}
+		}
+	}
+
+	merged := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Gateway",
+			"version": version,
+		},
+		"servers": []interface{}{map[string]interface{}{"url": "/"}},
+		"paths":   paths,
+	}
+
+	if len(components) > 0 {
+		merged["components"] = components
+	}
+
+	if len(tags) > 0 {
+		list := make([]interface{}, 0, len(tags))
+		for _, name := range sortedKeys(tags) {
+			list = append(list, tags[name])
+		}
+		merged["tags"] = list
+	}
+
+	return merged, errs
+}
+
+// namespaceCollisions returns the references to rename for each specification, for components that services define differently
+//
+// Components are compared with the renames applied, so a component that references a renamed component is renamed too. This
+// repeats until no more components are renamed.
+func namespaceCollisions(specs []fetched) []map[string]string {
+	defined := map[string][]int{}
+	values := map[string][]interface{}{}
+
+	for i, f := range specs {
+		for _, section := range sections {
+			components, _ := lookup(f.doc, "components", section).(map[string]interface{})
+			for name, value := range components {
+				key := ref(section, name)
+				defined[key] = append(defined[key], i)
+				values[key] = append(values[key], value)
+			}
+		}
+	}
+
+	renames := make([]map[string]string, len(specs))
+	for i := range renames {
+		renames[i] = map[string]string{}
+	}
+
+	for renamed := true; renamed; {
+		renamed = false
+
+		for key, indexes := range defined {
+			if _, ok := renames[indexes[0]][key]; ok {
+				continue
+			}
+
+			first := rewriteRefs(values[key][0], renames[indexes[0]])
+			same := true
+			for j, value := range values[key][1:] {
+				if !reflect.DeepEqual(rewriteRefs(value, renames[indexes[j+1]]), first) {
+					same = false
+					break
+				}
+			}
+
+			if same {
+				continue
+			}
+
+			section, name := splitRef(key)
+			for _, i := range indexes {
+				renames[i][key] = ref(section, namespace(specs[i].source.Path)+"_"+name)
+			}
+			renamed = true
+		}
+	}
+
+	return renames
+}
+
+// rewriteRefs returns a copy of the value with the renamed references replaced
+func rewriteRefs(v interface{}, renames map[string]string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if s, ok := value.(string); ok && key == "$ref" {
+				if renamed, ok := renames[s]; ok {
+					value = renamed
+				}
+			}
+			copied[key] = rewriteRefs(value, renames)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, value := range v {
+			copied[i] = rewriteRefs(value, renames)
+		}
+		return copied
+	}
+
+	return v
+}
+
+func ref(section, name string) string {
+	return "#/components/" + section + "/" + name
+}
+
+func splitRef(r string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(r, "#/components/"), "/", 2)
+	return parts[0], parts[1]
+}
+
+// namespace converts a service path (/api/test) to a component name prefix (api_test), the site root is root
+func namespace(path string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.Trim(path, "/"))
+
+	if name == "" {
+		return "root"
+	}
+
+	return name
+}
+
+func lookup(doc map[string]interface{}, keys ...string) interface{} {
+	var v interface{} = doc
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// basePath returns the path of the first server of the specification, the paths of the specification are relative to it
+func basePath(doc map[string]interface{}) string {
+	servers, _ := doc["servers"].([]interface{})
+	if len(servers) == 0 {
+		return ""
+	}
+
+	server, _ := servers[0].(map[string]interface{})
+	raw, _ := server["url"].(string)
+	if strings.Contains(raw, "{") {
+		return ""
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+func joinPath(base, p string) string {
+	if base == "" {
+		return p
+	}
+	return base + "/" + strings.TrimPrefix(p, "/")
+}
+
+// route returns the gateway path that is proxied to the backend path, the reverse of how the service directs requests
+func route(source Source, backendPath string) (string, bool) {
+	mount := strings.TrimSuffix(source.Path, "/")
+
+	if source.Target.Path == "" {
+		// requests are passed through as is, so only the backend paths within the mounted path can be reached
+		if mount == "" || backendPath == mount || strings.HasPrefix(backendPath, mount+"/") {
+			return backendPath, true
+		}
+		return "", false
+	}
+
+	target := strings.TrimSuffix(source.Target.Path, "/")
+	if backendPath != target && !strings.HasPrefix(backendPath, target+"/") && target != "" {
+		return "", false
+	}
+
+	routed := mount + strings.TrimPrefix(backendPath, target)
+	if routed == "" {
+		routed = "/"
+	}
+
+	return routed, true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
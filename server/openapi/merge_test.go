@@ -0,0 +1,179 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func parse(t *testing.T, doc string) map[string]interface{} {
+	t.Helper()
+
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatalf("invalid test document: %v", err)
+	}
+	return v
+}
+
+func source(path, target string) Source {
+	u, _ := url.Parse(target)
+	return Source{Path: path, Target: u, Spec: "/spec.json"}
+}
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		path, target, backend, routed string
+		ok                            bool
+	}{
+		{"/api/test", "http://test:8000/", "/pets/{id}", "/api/test/pets/{id}", true},
+		{"/api/test", "http://test:8000/v1", "/v1/pets", "/api/test/pets", true},
+		{"/api/test", "http://test:8000/v1", "/v2/pets", "", false},
+		{"/api/test", "http://test:8000/v1", "/v1", "/api/test", true},
+		{"/health/check", "http://127.0.0.1:8080", "/health/check", "/health/check", true},
+		{"/health/check", "http://127.0.0.1:8080", "/health/live", "", false},
+		{"/", "http://127.0.0.1:8080", "/anything", "/anything", true},
+	}
+
+	for _, tt := range tests {
+		routed, ok := route(source(tt.path, tt.target), tt.backend)
+		if routed != tt.routed || ok != tt.ok {
+			t.Errorf("%s -> %s%s: expected %q %v, got %q %v", tt.path, tt.target, tt.backend, tt.routed, tt.ok, routed, ok)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	pets := parse(t, `{
+		"openapi": "3.0.0",
+		"servers": [{"url": "https://pets.example.org/v1"}],
+		"security": [{"key": []}],
+		"tags": [{"name": "pets"}],
+		"paths": {
+			"/pets": {"get": {"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}}},
+			"/pets/{id}": {"get": {"security": [], "responses": {"200": {"$ref": "#/components/responses/Error"}}}}
+		},
+		"components": {
+			"schemas": {"Pet": {"type": "object", "properties": {"name": {"type": "string"}}}},
+			"responses": {"Error": {"description": "error"}}
+		}
+	}`)
+
+	stores := parse(t, `{
+		"openapi": "3.0.3",
+		"paths": {
+			"/stores": {"get": {"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}}},
+			"/other": {"get": {"responses": {"200": {"$ref": "#/components/responses/Error"}}}}
+		},
+		"components": {
+			"schemas": {"Pet": {"type": "string"}},
+			"responses": {"Error": {"description": "error"}}
+		}
+	}`)
+
+	merged, errs := merge("1.0.0", []fetched{
+		{source: source("/pets", "http://pets/v1"), doc: pets},
+		{source: source("/", "http://stores"), doc: stores},
+		{source: source("/down", "http://down"), err: errors.New("connection refused")},
+		{source: source("/swagger", "http://swagger"), doc: parse(t, `{"swagger": "2.0"}`)},
+	})
+
+	if len(errs) != 2 || errs[0].Service != "/down" || errs[1].Service != "/swagger" {
+		t.Errorf("expected the unreachable and invalid specifications to be reported, got %+v", errs)
+	}
+
+	paths := merged["paths"].(map[string]interface{})
+	for _, p := range []string{"/pets/pets", "/pets/pets/{id}", "/stores", "/other"} {
+		if _, ok := paths[p]; !ok {
+			t.Errorf("expected path %s in %v", p, paths)
+		}
+	}
+
+	schemas := lookup(merged, "components", "schemas").(map[string]interface{})
+	if _, ok := schemas["pets_Pet"]; !ok {
+		t.Errorf("expected the differing Pet schemas to be namespaced, got %v", schemas)
+	}
+	if _, ok := schemas["root_Pet"]; !ok {
+		t.Errorf("expected the differing Pet schemas to be namespaced, got %v", schemas)
+	}
+
+	responses := lookup(merged, "components", "responses").(map[string]interface{})
+	if _, ok := responses["Error"]; !ok || len(responses) != 1 {
+		t.Errorf("expected the identical Error responses to be shared, got %v", responses)
+	}
+
+	ref := lookup(paths["/stores"].(map[string]interface{}), "get", "responses", "200", "content", "application/json", "schema", "$ref")
+	if ref != "#/components/schemas/root_Pet" {
+		t.Errorf("expected the reference to be renamed, got %v", ref)
+	}
+
+	get := paths["/pets/pets"].(map[string]interface{})["get"].(map[string]interface{})
+	if !reflect.DeepEqual(get["security"], []interface{}{map[string]interface{}{"key": []interface{}{}}}) {
+		t.Errorf("expected the specification security to apply to the operation, got %v", get["security"])
+	}
+
+	getOne := paths["/pets/pets/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+	if !reflect.DeepEqual(getOne["security"], []interface{}{}) {
+		t.Errorf("expected the operation security to be kept, got %v", getOne["security"])
+	}
+
+	if pets["components"].(map[string]interface{})["schemas"].(map[string]interface{})["Pet"] == nil {
+		t.Error("expected the service specification to be left unchanged")
+	}
+}
+
+func TestMergePathCollision(t *testing.T) {
+	doc := `{"openapi": "3.0.0", "paths": {"/api/items": {"get": {}}}}`
+
+	merged, errs := merge("1.0.0", []fetched{
+		{source: source("/api", "http://one"), doc: parse(t, doc)},
+		{source: source("/api/items", "http://two"), doc: parse(t, doc)},
+	})
+
+	if len(errs) != 1 || errs[0].Service != "/api/items" {
+		t.Errorf("expected the second service to be reported, got %+v", errs)
+	}
+
+	if paths := merged["paths"].(map[string]interface{}); len(paths) != 1 {
+		t.Errorf("expected a single path, got %v", paths)
+	}
+}
+
+func TestMergeNamespacesComponentsReferencingCollisions(t *testing.T) {
+	spec := func(petType string) map[string]interface{} {
+		return parse(t, `{
+			"openapi": "3.0.0",
+			"paths": {"/orders": {"get": {"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Order"}}}}}}}},
+			"components": {"schemas": {
+				"Order": {"type": "object", "properties": {"pet": {"$ref": "#/components/schemas/Pet"}}},
+				"Line": {"type": "object", "properties": {"order": {"$ref": "#/components/schemas/Order"}}},
+				"Pet": {"type": "`+petType+`"}
+			}}
+		}`)
+	}
+
+	merged, errs := merge("1.0.0", []fetched{
+		{source: source("/a", "http://a/"), doc: spec("object")},
+		{source: source("/b", "http://b/"), doc: spec("string")},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+
+	schemas := lookup(merged, "components", "schemas").(map[string]interface{})
+	for _, name := range []string{"a_Pet", "b_Pet", "a_Order", "b_Order", "a_Line", "b_Line"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("expected %s to be namespaced, got %v", name, sortedKeys(schemas))
+		}
+	}
+
+	if r := lookup(schemas, "b_Order", "properties", "pet", "$ref"); r != "#/components/schemas/b_Pet" {
+		t.Errorf("expected b_Order to reference b_Pet, got %v", r)
+	}
+
+	if r := lookup(merged, "paths", "/a/orders", "get", "responses", "200", "content", "application/json", "schema", "$ref"); r != "#/components/schemas/a_Order" {
+		t.Errorf("expected the operation to reference a_Order, got %v", r)
+	}
+}
@@ -0,0 +1,377 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/renevo/gateway/logging"
+)
+
+const (
+	defaultRefresh = time.Minute
+	fetchTimeout   = time.Second * 10
+
+	// maxSpecSize limits how much of a service specification is read
+	maxSpecSize = 10 << 20
+)
+
+// Source is a backend service with an OpenAPI specification
+type Source struct {
+	// Path the service is mounted at
+	Path string
+	// Target is the backend service address
+	Target *url.URL
+	// Spec is a path on the backend service, or an absolute URL
+	Spec string
+	// Transport connects to the backend service, nil for the default transport
+	Transport http.RoundTripper
+}
+
+// Spec serves the merged OpenAPI specification of the backend services
+//
+// The service specifications are fetched again at the refresh interval, and whenever the services are updated. A service
+// specification that can't be fetched or merged is listed in x-gateway-errors instead of failing the whole document. The
+// service specifications are also used to validate requests to the services.
+type Spec struct {
+	version string
+	refresh time.Duration
+
+	mu         sync.RWMutex
+	sources    []Source
+	json       []byte
+	yaml       []byte
+	operations map[string]*operations
+
+	update chan struct{}
+	ready  chan struct{}
+	stop   chan struct{}
+	once   sync.Once
+	start  sync.Once
+}
+
+// New creates the merged specification, refreshed at the interval (1m by default)
+func New(version string, refresh time.Duration) *Spec {
+	if refresh <= 0 {
+		refresh = defaultRefresh
+	}
+
+	return &Spec{
+		version: version,
+		refresh: refresh,
+		update:  make(chan struct{}, 1),
+		ready:   make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Update replaces the services (e.g. when discovery finds a change) and merges their specifications again
+func (s *Spec) Update(sources []Source) {
+	s.mu.Lock()
+	s.sources = sources
+	s.mu.Unlock()
+
+	s.start.Do(func() { go s.run() })
+
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops refreshing the specification
+func (s *Spec) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *Spec) run() {
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.update:
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+
+		s.Refresh()
+	}
+}
+
+// Refresh fetches and merges the service specifications
+func (s *Spec) Refresh() {
+	s.mu.RLock()
+	sources := s.sources
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	specs := make([]fetched, len(sources))
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source Source) {
+			defer wg.Done()
+			doc, err := fetch(source)
+			specs[i] = fetched{source: source, doc: doc, err: err}
+		}(i, source)
+	}
+	wg.Wait()
+
+	operations := make(map[string]*operations, len(specs))
+	for _, f := range specs {
+		if v, _ := f.doc["openapi"].(string); f.err == nil && strings.HasPrefix(v, "3.") {
+			operations[f.source.Path] = compile(f.source, f.doc)
+		}
+	}
+
+	merged, errs := merge(s.version, specs)
+	for _, err := range errs {
+		logging.Warnf("Failed to merge the OpenAPI specification %s of %s: %s", err.Spec, err.Service, err.Error)
+	}
+
+	if len(errs) > 0 {
+		merged["x-gateway-errors"] = errs
+	}
+
+	jsonDoc, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		logging.Errorf("Failed to write the OpenAPI specification: %v", err)
+		return
+	}
+
+	yamlDoc, err := yaml.Marshal(merged)
+	if err != nil {
+		logging.Errorf("Failed to write the OpenAPI specification: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.json, s.yaml = jsonDoc, yamlDoc
+	for _, source := range sources {
+		// keep validating with the last specification fetched until a new one can be
+		if _, ok := operations[source.Path]; !ok && s.operations[source.Path] != nil {
+			operations[source.Path] = s.operations[source.Path]
+		}
+	}
+	s.operations = operations
+	s.mu.Unlock()
+
+	select {
+	case <-s.ready:
+	default:
+		close(s.ready)
+	}
+}
+
+// fetch reads the JSON specification of the service
+func fetch(source Source) (map[string]interface{}, error) {
+	spec, err := specURL(source)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spec, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	transport := source.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	res, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response %s", res.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSpecSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid specification: %v", err)
+	}
+
+	return doc, nil
+}
+
+// specURL resolves the specification against the backend service address
+func specURL(source Source) (string, error) {
+	u, err := url.Parse(source.Spec)
+	if err != nil {
+		return "", err
+	}
+
+	if u.IsAbs() {
+		return u.String(), nil
+	}
+
+	resolved := *source.Target
+	resolved.Path = "/" + strings.TrimPrefix(u.Path, "/")
+	resolved.RawPath = ""
+	resolved.RawQuery = u.RawQuery
+	return resolved.String(), nil
+}
+
+// ServeHTTP writes the merged specification, as YAML for paths ending in .yaml or .yml or when YAML is preferred, otherwise JSON
+func (s *Spec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-s.ready:
+	case <-r.Context().Done():
+		return
+	}
+
+	s.mu.RLock()
+	jsonDoc, yamlDoc := s.json, s.yaml
+	s.mu.RUnlock()
+
+	w.Header().Set("Vary", "Accept")
+
+	if format(r, false) == mimeYAML {
+		w.Header().Set("Content-Type", mimeYAML)
+		w.Write(yamlDoc)
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeJSON)
+	w.Write(jsonDoc)
+}
+
+// Handler serves the specification at path, and the Swagger UI to browsers when ui is not nil
+//
+// Browsers (preferring text/html) requesting the path are redirected to path/, where the UI is served, with a generated
+// swagger-initializer.js that loads the merged specification.
+func (s *Spec) Handler(path string, ui http.Handler) http.Handler {
+	if ui == nil {
+		return s
+	}
+
+	initializer := []byte(fmt.Sprintf(swaggerInitializer, path+".json"))
+	files := http.StripPrefix(path, ui)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == path+"/swagger-initializer.js":
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			w.Write(initializer)
+		case strings.HasPrefix(r.URL.Path, path+"/"):
+			files.ServeHTTP(w, r)
+		case r.URL.Path == path && format(r, true) == mimeHTML:
+			w.Header().Set("Vary", "Accept")
+			http.Redirect(w, r, path+"/", http.StatusFound)
+		default:
+			s.ServeHTTP(w, r)
+		}
+	})
+}
+
+const (
+	mimeJSON = "application/json"
+	mimeYAML = "application/yaml"
+	mimeHTML = "text/html"
+)
+
+// format returns the media type to respond with, from the extension of the path or the preferred accepted type
+//
+// JSON is used when the request accepts anything, or nothing that is offered.
+func format(r *http.Request, html bool) string {
+	switch {
+	case strings.HasSuffix(r.URL.Path, ".json"):
+		return mimeJSON
+	case strings.HasSuffix(r.URL.Path, ".yaml"), strings.HasSuffix(r.URL.Path, ".yml"):
+		return mimeYAML
+	}
+
+	offers := []string{mimeJSON, mimeYAML}
+	if html {
+		offers = append(offers, mimeHTML)
+	}
+
+	best, bestQ := mimeJSON, 0.0
+	for _, offer := range offers {
+		if q := quality(r.Header.Get("Accept"), offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// quality returns the highest q value of the accepted media ranges that match the media type
+func quality(accept, mediaType string) float64 {
+	if accept == "" {
+		accept = "*/*"
+	}
+
+	best := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		accepted := strings.ToLower(strings.TrimSpace(params[0]))
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		// the exact type is preferred over a wildcard with the same q value
+		switch {
+		case accepted == mediaType, mediaType == mimeYAML && (accepted == "text/yaml" || accepted == "application/x-yaml"):
+		case accepted == "*/*", strings.HasSuffix(accepted, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(accepted, "*")):
+			q -= 0.0001
+		default:
+			continue
+		}
+
+		if q > best {
+			best = q
+		}
+	}
+
+	return best
+}
+
+// swaggerInitializer replaces the initializer of the Swagger UI distribution (4.9 and later) to load the merged specification
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: %q,
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
@@ -0,0 +1,137 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSpecFetchesAndServes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/spec.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"openapi": "3.0.0", "paths": {"/items": {"get": {}}}}`))
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL + "/")
+	missing, _ := url.Parse(backend.URL + "/")
+
+	spec := New("1.0.0", 0)
+	defer spec.Close()
+	spec.Update([]Source{
+		{Path: "/api", Target: target, Spec: "/spec.json"},
+		{Path: "/missing", Target: missing, Spec: "/missing.json"},
+	})
+
+	rec := httptest.NewRecorder()
+	spec.ServeHTTP(rec, httptest.NewRequest("GET", "/api/specification", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected json, got %q", ct)
+	}
+
+	var doc struct {
+		Paths  map[string]interface{} `json:"paths"`
+		Errors []SpecError            `json:"x-gateway-errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	if _, ok := doc.Paths["/api/items"]; !ok {
+		t.Errorf("expected the routed service path, got %v", doc.Paths)
+	}
+
+	if len(doc.Errors) != 1 || !strings.Contains(doc.Errors[0].Error, "404") {
+		t.Errorf("expected the missing specification to be reported, got %+v", doc.Errors)
+	}
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/api/specification.yaml", nil),
+		func() *http.Request {
+			r := httptest.NewRequest("GET", "/api/specification", nil)
+			r.Header.Set("Accept", "application/yaml")
+			return r
+		}(),
+	} {
+		rec := httptest.NewRecorder()
+		spec.ServeHTTP(rec, r)
+
+		var v map[string]interface{}
+		if err := yaml.Unmarshal(rec.Body.Bytes(), &v); err != nil || rec.Header().Get("Content-Type") != "application/yaml" || v["openapi"] != "3.0.3" {
+			t.Errorf("%s: expected yaml, got %s %v", r.URL, rec.Header().Get("Content-Type"), err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		path, accept, expected string
+	}{
+		{"/spec", "", mimeJSON},
+		{"/spec", "*/*", mimeJSON},
+		{"/spec", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", mimeHTML},
+		{"/spec", "application/json", mimeJSON},
+		{"/spec", "application/json;q=0.5, text/yaml", mimeYAML},
+		{"/spec", "application/*", mimeJSON},
+		{"/spec", "image/png", mimeJSON},
+		{"/spec.yml", "text/html", mimeYAML},
+		{"/spec.json", "text/html", mimeJSON},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Accept", tt.accept)
+		if actual := format(r, true); actual != tt.expected {
+			t.Errorf("%s %q: expected %s, got %s", tt.path, tt.accept, tt.expected, actual)
+		}
+	}
+}
+
+func TestHandlerServesUI(t *testing.T) {
+	ui := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ui " + r.URL.Path))
+	})
+
+	spec := New("1.0.0", 0)
+	defer spec.Close()
+	spec.Update(nil)
+
+	h := spec.Handler("/api/specification", ui)
+
+	browser := httptest.NewRequest("GET", "/api/specification", nil)
+	browser.Header.Set("Accept", "text/html,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, browser)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/api/specification/" {
+		t.Errorf("expected a redirect to the ui, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/specification/swagger-ui.css", nil))
+	if rec.Body.String() != "ui /swagger-ui.css" {
+		t.Errorf("expected the ui file, got %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/specification/swagger-initializer.js", nil))
+	if !strings.Contains(rec.Body.String(), `url: "/api/specification.json"`) {
+		t.Errorf("expected the initializer to load the merged spec, got %q", rec.Body.String())
+	}
+
+	api := httptest.NewRequest("GET", "/api/specification", nil)
+	api.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, api)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != mimeJSON {
+		t.Errorf("expected the json spec, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
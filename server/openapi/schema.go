@@ -0,0 +1,420 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxSchemaDepth stops a schema that references itself without consuming any of the value
+const maxSchemaDepth = 64
+
+// schemaValidator checks values decoded from JSON against the schemas of a single service specification
+//
+// The OpenAPI 3.0 schema keywords are supported, along with the 3.1 forms of type (a list) and the exclusive bounds (numbers).
+// Formats are not checked, they are annotations unless a validator opts in.
+type schemaValidator struct {
+	doc map[string]interface{}
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+func newSchemaValidator(doc map[string]interface{}) *schemaValidator {
+	return &schemaValidator{doc: doc, patterns: make(map[string]*regexp.Regexp)}
+}
+
+// validate returns the violations of the value, named with a JSON pointer from the name given when nested values fail
+func (v *schemaValidator) validate(schema interface{}, value interface{}, in, name string) []Violation {
+	var violations []Violation
+	v.check(schema, value, name, 0, func(pointer, message string) {
+		violations = append(violations, Violation{In: in, Name: pointer, Message: message})
+	})
+	return violations
+}
+
+// resolve follows the $ref of the schema (or any other object) to its definition within the document
+func (v *schemaValidator) resolve(value interface{}) (map[string]interface{}, error) {
+	for depth := 0; depth < maxSchemaDepth; depth++ {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+
+		r, ok := m["$ref"].(string)
+		if !ok {
+			return m, nil
+		}
+
+		if !strings.HasPrefix(r, "#/") {
+			return nil, fmt.Errorf("unsupported reference %s", r)
+		}
+
+		value = v.doc
+		for _, token := range strings.Split(r[2:], "/") {
+			token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+			value = lookup(asMap(value), token)
+		}
+
+		if value == nil {
+			return nil, fmt.Errorf("unresolved reference %s", r)
+		}
+	}
+
+	return nil, fmt.Errorf("too many nested references")
+}
+
+func (v *schemaValidator) check(raw interface{}, value interface{}, pointer string, depth int, fail func(pointer, message string)) {
+	if depth > maxSchemaDepth {
+		return
+	}
+
+	schema, err := v.resolve(raw)
+	if err != nil {
+		fail(pointer, err.Error())
+		return
+	}
+
+	if schema == nil {
+		// a missing schema (or true) accepts anything, false accepts nothing
+		if b, ok := raw.(bool); ok && !b {
+			fail(pointer, "is not allowed")
+		}
+		return
+	}
+
+	if value == nil && schema["nullable"] == true {
+		return
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 && !matchesType(types, value) {
+		fail(pointer, fmt.Sprintf("must be %s, got %s", strings.Join(types, " or "), typeOf(value)))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !contains(enum, value) {
+		fail(pointer, fmt.Sprintf("must be one of %s", describe(enum)))
+	}
+
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		fail(pointer, fmt.Sprintf("must be %s", describe([]interface{}{constant})))
+	}
+
+	switch value := value.(type) {
+	case string:
+		v.checkString(schema, value, pointer, fail)
+	case float64:
+		checkNumber(schema, value, pointer, fail)
+	case []interface{}:
+		v.checkArray(schema, value, pointer, depth, fail)
+	case map[string]interface{}:
+		v.checkObject(schema, value, pointer, depth, fail)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			v.check(s, value, pointer, depth+1, fail)
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, s := range anyOf {
+			if v.matches(s, value, pointer, depth) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail(pointer, "must match at least one schema of anyOf")
+		}
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, s := range oneOf {
+			if v.matches(s, value, pointer, depth) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail(pointer, fmt.Sprintf("must match exactly one schema of oneOf, matched %d", matched))
+		}
+	}
+
+	if not, ok := schema["not"]; ok && v.matches(not, value, pointer, depth) {
+		fail(pointer, "must not match the schema of not")
+	}
+}
+
+// matches returns true when the value has no violations of the schema
+func (v *schemaValidator) matches(schema interface{}, value interface{}, pointer string, depth int) bool {
+	matched := true
+	v.check(schema, value, pointer, depth+1, func(string, string) { matched = false })
+	return matched
+}
+
+func (v *schemaValidator) checkString(schema map[string]interface{}, value, pointer string, fail func(pointer, message string)) {
+	length := float64(utf8.RuneCountInString(value))
+
+	if min, ok := number(schema["minLength"]); ok && length < min {
+		fail(pointer, fmt.Sprintf("must be at least %s characters", format64(min)))
+	}
+
+	if max, ok := number(schema["maxLength"]); ok && length > max {
+		fail(pointer, fmt.Sprintf("must be at most %s characters", format64(max)))
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := v.pattern(pattern)
+		if err != nil {
+			fail(pointer, fmt.Sprintf("has an invalid pattern %q in the specification", pattern))
+		} else if !re.MatchString(value) {
+			fail(pointer, fmt.Sprintf("must match the pattern %q", pattern))
+		}
+	}
+}
+
+func (v *schemaValidator) pattern(pattern string) (*regexp.Regexp, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if re, ok := v.patterns[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	v.patterns[pattern] = re
+	return re, nil
+}
+
+func checkNumber(schema map[string]interface{}, value float64, pointer string, fail func(pointer, message string)) {
+	if min, ok := number(schema["minimum"]); ok {
+		if schema["exclusiveMinimum"] == true && value <= min {
+			fail(pointer, fmt.Sprintf("must be greater than %s", format64(min)))
+		} else if value < min {
+			fail(pointer, fmt.Sprintf("must be at least %s", format64(min)))
+		}
+	}
+
+	if max, ok := number(schema["maximum"]); ok {
+		if schema["exclusiveMaximum"] == true && value >= max {
+			fail(pointer, fmt.Sprintf("must be less than %s", format64(max)))
+		} else if value > max {
+			fail(pointer, fmt.Sprintf("must be at most %s", format64(max)))
+		}
+	}
+
+	// OpenAPI 3.1 (JSON Schema) exclusive bounds are numbers
+	if min, ok := number(schema["exclusiveMinimum"]); ok && value <= min {
+		fail(pointer, fmt.Sprintf("must be greater than %s", format64(min)))
+	}
+
+	if max, ok := number(schema["exclusiveMaximum"]); ok && value >= max {
+		fail(pointer, fmt.Sprintf("must be less than %s", format64(max)))
+	}
+
+	if multiple, ok := number(schema["multipleOf"]); ok && multiple > 0 {
+		if q := value / multiple; math.Abs(q-math.Round(q)) > 1e-9 {
+			fail(pointer, fmt.Sprintf("must be a multiple of %s", format64(multiple)))
+		}
+	}
+}
+
+func (v *schemaValidator) checkArray(schema map[string]interface{}, value []interface{}, pointer string, depth int, fail func(pointer, message string)) {
+	if min, ok := number(schema["minItems"]); ok && float64(len(value)) < min {
+		fail(pointer, fmt.Sprintf("must have at least %s items", format64(min)))
+	}
+
+	if max, ok := number(schema["maxItems"]); ok && float64(len(value)) > max {
+		fail(pointer, fmt.Sprintf("must have at most %s items", format64(max)))
+	}
+
+	if schema["uniqueItems"] == true {
+		for i := range value {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(value[i], value[j]) {
+					fail(pointer, fmt.Sprintf("must have unique items, %d is the same as %d", i, j))
+				}
+			}
+		}
+	}
+
+	if items, ok := schema["items"]; ok {
+		for i, item := range value {
+			v.check(items, item, pointer+"/"+strconv.Itoa(i), depth+1, fail)
+		}
+	}
+}
+
+func (v *schemaValidator) checkObject(schema map[string]interface{}, value map[string]interface{}, pointer string, depth int, fail func(pointer, message string)) {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := value[name]; ok {
+				continue
+			}
+
+			// read only properties are only sent in responses, so they are never required in a request
+			if property, _ := v.resolve(properties[name]); property != nil && property["readOnly"] == true {
+				continue
+			}
+
+			fail(pointer+"/"+escapePointer(name), "is required")
+		}
+	}
+
+	if min, ok := number(schema["minProperties"]); ok && float64(len(value)) < min {
+		fail(pointer, fmt.Sprintf("must have at least %s properties", format64(min)))
+	}
+
+	if max, ok := number(schema["maxProperties"]); ok && float64(len(value)) > max {
+		fail(pointer, fmt.Sprintf("must have at most %s properties", format64(max)))
+	}
+
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, name := range sortedKeys(value) {
+		location := pointer + "/" + escapePointer(name)
+
+		if property, ok := properties[name]; ok {
+			v.check(property, value[name], location, depth+1, fail)
+			continue
+		}
+
+		if !hasAdditional {
+			continue
+		}
+
+		if b, ok := additional.(bool); ok {
+			if !b {
+				fail(location, "is not an allowed property")
+			}
+			continue
+		}
+
+		v.check(additional, value[name], location, depth+1, fail)
+	}
+}
+
+// schemaTypes returns the allowed types of the schema, a 3.0 nullable schema also allows null
+func schemaTypes(schema map[string]interface{}) []string {
+	var types []string
+	switch t := schema["type"].(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+
+	return types
+}
+
+func matchesType(types []string, value interface{}) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || t == "integer" && v == math.Trunc(v) {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+func contains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			parts[i] = strconv.Quote(s)
+		} else {
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func format64(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+// escapePointer escapes a property name as a JSON pointer token
+func escapePointer(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,89 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	doc := parse(t, `{
+		"components": {
+			"schemas": {
+				"Pet": {
+					"type": "object",
+					"required": ["id", "name"],
+					"additionalProperties": false,
+					"properties": {
+						"id": {"type": "integer", "readOnly": true},
+						"name": {"type": "string", "minLength": 1, "maxLength": 10, "pattern": "^[a-z]+$"},
+						"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": true, "maximum": 30},
+						"kind": {"type": "string", "enum": ["cat", "dog"]},
+						"owner": {"type": "string", "nullable": true},
+						"tags": {"type": "array", "maxItems": 2, "uniqueItems": true, "items": {"type": "string"}},
+						"friend": {"$ref": "#/components/schemas/Pet"}
+					}
+				}
+			}
+		}
+	}`)
+
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{`{"name": "rex", "age": 3, "kind": "dog", "owner": null, "tags": ["a"]}`, nil},
+		{`[]`, []string{" must be object, got array"}},
+		{`{}`, []string{"/name is required"}},
+		{`{"name": "Rex"}`, []string{`/name must match the pattern "^[a-z]+$"`}},
+		{`{"name": "rex", "age": 30}`, []string{"/age must be less than 30"}},
+		{`{"name": "rex", "age": 1.5}`, []string{"/age must be integer, got number"}},
+		{`{"name": "rex", "kind": "fish"}`, []string{`/kind must be one of "cat", "dog"`}},
+		{`{"name": "rex", "tags": ["a", "a", "b"]}`, []string{"/tags must have at most 2 items", "/tags must have unique items, 1 is the same as 0"}},
+		{`{"name": "rex", "tags": [1]}`, []string{"/tags/0 must be string, got integer"}},
+		{`{"name": "rex", "color": "red"}`, []string{"/color is not an allowed property"}},
+		{`{"name": "rex", "friend": {"name": ""}}`, []string{"/friend/name must be at least 1 characters", `/friend/name must match the pattern "^[a-z]+$"`}},
+	}
+
+	v := newSchemaValidator(doc)
+	schema := map[string]interface{}{"$ref": "#/components/schemas/Pet"}
+
+	for _, tt := range tests {
+		var messages []string
+		for _, violation := range v.validate(schema, parse(t, `{"v": `+tt.value+`}`)["v"], "body", "") {
+			messages = append(messages, violation.Name+" "+violation.Message)
+		}
+
+		if !reflect.DeepEqual(messages, tt.expected) {
+			t.Errorf("%s: expected %q, got %q", tt.value, tt.expected, messages)
+		}
+	}
+}
+
+func TestSchemaComposition(t *testing.T) {
+	v := newSchemaValidator(nil)
+
+	tests := []struct {
+		schema, value string
+		valid         bool
+	}{
+		{`{"oneOf": [{"type": "string"}, {"type": "integer"}]}`, `"a"`, true},
+		{`{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `1`, false},
+		{`{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `true`, false},
+		{`{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, `2`, true},
+		{`{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, `4`, false},
+		{`{"not": {"type": "null"}}`, `null`, false},
+		{`{"type": ["string", "null"]}`, `null`, true},
+		{`{"exclusiveMinimum": 0}`, `0`, false},
+		{`{"multipleOf": 0.1}`, `0.3`, true},
+		{`{"$ref": "#/components/schemas/Missing"}`, `1`, false},
+	}
+
+	for _, tt := range tests {
+		schema := parse(t, `{"v": `+tt.schema+`}`)["v"]
+		value := parse(t, `{"v": `+tt.value+`}`)["v"]
+
+		if violations := v.validate(schema, value, "body", ""); (len(violations) == 0) != tt.valid {
+			t.Errorf("%s %s: expected valid %v, got %v", tt.schema, tt.value, tt.valid, violations)
+		}
+	}
+}
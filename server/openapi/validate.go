@@ -0,0 +1,469 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/renevo/gateway/logging"
+)
+
+// maxBodySize limits how much of a request body is read to validate it, larger bodies are passed through unchecked
+const maxBodySize = 10 << 20
+
+// Mode is how requests that don't match the specification of a service are handled
+type Mode string
+
+const (
+	// Off passes requests through without validating them
+	Off Mode = ""
+	// Enforce rejects invalid requests with a problem details (RFC 7807) response listing the violations
+	Enforce Mode = "enforce"
+	// ReportOnly logs the violations of invalid requests and passes them through
+	ReportOnly Mode = "report-only"
+)
+
+// ParseMode returns the validation mode by name, an empty name is Off
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(name)); mode {
+	case Off, Enforce, ReportOnly:
+		return mode, nil
+	}
+
+	return Off, fmt.Errorf("unknown validation mode %q, expected %s or %s", name, Enforce, ReportOnly)
+}
+
+// Violation is a part of a request that doesn't match the specification
+type Violation struct {
+	// In is where the value is: path, query, header, cookie or body
+	In string `json:"in"`
+	// Name is the parameter, or a JSON pointer to the value within the body
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Name == "" {
+		return v.In + " " + v.Message
+	}
+	return v.In + " " + v.Name + " " + v.Message
+}
+
+// problem is an RFC 7807 problem details response
+type problem struct {
+	Type       string      `json:"type"`
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail"`
+	Instance   string      `json:"instance,omitempty"`
+	Violations []Violation `json:"violations"`
+}
+
+// Validate checks requests to the service mounted at path against its specification before they are passed to h
+//
+// Requests are passed through until the specification has been fetched, and when no operation of the specification matches
+// them. When a specification can no longer be fetched, the last one fetched is used.
+func (s *Spec) Validate(path string, mode Mode, h http.Handler) http.Handler {
+	if mode == Off {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		ops := s.operations[path]
+		s.mu.RUnlock()
+
+		violations := ops.validate(r)
+		if len(violations) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		messages := make([]string, len(violations))
+		for i, v := range violations {
+			messages[i] = v.String()
+		}
+
+		if mode == ReportOnly {
+			logging.FromContext(r.Context()).Warnf("Request %s %s does not match the specification of %s: %s", r.Method, r.URL.Path, path, strings.Join(messages, "; "))
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		logging.FromContext(r.Context()).Debugf("Rejected request %s %s that does not match the specification of %s: %s", r.Method, r.URL.Path, path, strings.Join(messages, "; "))
+
+		body, _ := json.Marshal(problem{
+			Type:       "about:blank",
+			Title:      http.StatusText(http.StatusBadRequest),
+			Status:     http.StatusBadRequest,
+			Detail:     "The request does not match the OpenAPI specification of the service.",
+			Instance:   r.URL.Path,
+			Violations: violations,
+		})
+
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(body)
+	})
+}
+
+// operations are the operations of a single service specification, with the paths rewritten to the routed paths
+type operations struct {
+	schemas *schemaValidator
+	paths   []pathItem
+}
+
+type pathItem struct {
+	pattern  *regexp.Regexp
+	names    []string
+	literals int
+	methods  map[string]*operation
+}
+
+type operation struct {
+	parameters []parameter
+	body       map[string]interface{}
+}
+
+type parameter struct {
+	name     string
+	in       string
+	required bool
+	schema   interface{}
+	style    string
+	explode  bool
+}
+
+// ignoredHeaders are described by other parts of the specification, so header parameters with these names are ignored
+var ignoredHeaders = map[string]bool{"Accept": true, "Content-Type": true, "Authorization": true}
+
+// templateParameter matches a path template parameter, e.g. {id}
+var templateParameter = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// compile prepares the operations of the service specification to validate requests
+func compile(source Source, doc map[string]interface{}) *operations {
+	ops := &operations{schemas: newSchemaValidator(doc)}
+	base := basePath(doc)
+
+	items, _ := doc["paths"].(map[string]interface{})
+	for _, p := range sortedKeys(items) {
+		routed, ok := route(source, joinPath(base, p))
+		if !ok {
+			continue
+		}
+
+		item, _ := ops.schemas.resolve(items[p])
+		if item == nil {
+			continue
+		}
+
+		compiled := pathItem{methods: make(map[string]*operation)}
+
+		expr := "^"
+		last := 0
+		for _, loc := range templateParameter.FindAllStringIndex(routed, -1) {
+			expr += regexp.QuoteMeta(routed[last:loc[0]]) + "([^/]+)"
+			compiled.names = append(compiled.names, routed[loc[0]+1:loc[1]-1])
+			compiled.literals += loc[0] - last
+			last = loc[1]
+		}
+		expr += regexp.QuoteMeta(routed[last:]) + "$"
+		compiled.literals += len(routed) - last
+
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		compiled.pattern = pattern
+
+		shared := ops.parameters(item["parameters"])
+		for _, method := range methods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			// operation parameters override the path parameters with the same name and location
+			params := ops.parameters(op["parameters"])
+			for _, p := range shared {
+				overridden := false
+				for _, o := range params {
+					if o.name == p.name && o.in == p.in {
+						overridden = true
+						break
+					}
+				}
+				if !overridden {
+					params = append(params, p)
+				}
+			}
+
+			body, _ := ops.schemas.resolve(op["requestBody"])
+			compiled.methods[strings.ToUpper(method)] = &operation{parameters: params, body: body}
+		}
+
+		ops.paths = append(ops.paths, compiled)
+	}
+
+	return ops
+}
+
+func (o *operations) parameters(v interface{}) []parameter {
+	list, _ := v.([]interface{})
+
+	var params []parameter
+	for _, raw := range list {
+		p, _ := o.schemas.resolve(raw)
+		if p == nil {
+			continue
+		}
+
+		param := parameter{schema: p["schema"]}
+		param.name, _ = p["name"].(string)
+		param.in, _ = p["in"].(string)
+		param.required = p["required"] == true || param.in == "path"
+
+		if param.in == "header" {
+			param.name = http.CanonicalHeaderKey(param.name)
+			if ignoredHeaders[param.name] {
+				continue
+			}
+		}
+
+		param.style, _ = p["style"].(string)
+		if param.style == "" {
+			param.style = "simple"
+			if param.in == "query" || param.in == "cookie" {
+				param.style = "form"
+			}
+		}
+
+		param.explode = param.style == "form"
+		if explode, ok := p["explode"].(bool); ok {
+			param.explode = explode
+		}
+
+		params = append(params, param)
+	}
+
+	return params
+}
+
+// match finds the operation for the request, concrete paths are matched before templated paths
+func (o *operations) match(r *http.Request) (*operation, map[string]string) {
+	path := r.URL.EscapedPath()
+
+	var best *pathItem
+	var values []string
+	for i := range o.paths {
+		item := &o.paths[i]
+		if best != nil && item.literals <= best.literals {
+			continue
+		}
+
+		if m := item.pattern.FindStringSubmatch(path); m != nil {
+			best, values = item, m[1:]
+		}
+	}
+
+	if best == nil || best.methods[r.Method] == nil {
+		return nil, nil
+	}
+
+	params := make(map[string]string, len(best.names))
+	for i, name := range best.names {
+		value, err := url.PathUnescape(values[i])
+		if err != nil {
+			value = values[i]
+		}
+		params[name] = value
+	}
+
+	return best.methods[r.Method], params
+}
+
+// validate returns the violations of the request, nothing when there is no specification or operation for the request
+func (o *operations) validate(r *http.Request) []Violation {
+	if o == nil {
+		return nil
+	}
+
+	op, pathParams := o.match(r)
+	if op == nil {
+		return nil
+	}
+
+	var violations []Violation
+	query := r.URL.Query()
+
+	for _, p := range op.parameters {
+		var raw []string
+		switch p.in {
+		case "path":
+			if value, ok := pathParams[p.name]; ok {
+				raw = []string{value}
+			}
+		case "query":
+			raw = query[p.name]
+		case "header":
+			raw = r.Header.Values(p.name)
+		case "cookie":
+			if c, err := r.Cookie(p.name); err == nil {
+				raw = []string{c.Value}
+			}
+		default:
+			continue
+		}
+
+		if len(raw) == 0 {
+			if p.required {
+				violations = append(violations, Violation{In: p.in, Name: p.name, Message: "is required"})
+			}
+			continue
+		}
+
+		if value, ok := o.decode(p, raw); ok {
+			violations = append(violations, o.schemas.validate(p.schema, value, p.in, p.name)...)
+		}
+	}
+
+	if op.body != nil {
+		violations = append(violations, o.validateBody(op.body, r)...)
+	}
+
+	return violations
+}
+
+// decode converts the parameter values to the types of the schema, objects are not decoded so they are not checked
+func (o *operations) decode(p parameter, raw []string) (interface{}, bool) {
+	schema, _ := o.schemas.resolve(p.schema)
+	if schema == nil {
+		return nil, false
+	}
+
+	types := schemaTypes(schema)
+	if hasType(types, "object") {
+		return nil, false
+	}
+
+	if !hasType(types, "array") {
+		return convert(raw[0], schemaTypes(schema)), true
+	}
+
+	items := raw
+	if !p.explode || p.style != "form" {
+		delimiter := ","
+		switch p.style {
+		case "spaceDelimited":
+			delimiter = " "
+		case "pipeDelimited":
+			delimiter = "|"
+		}
+		items = strings.Split(raw[0], delimiter)
+	}
+
+	itemSchema, _ := o.schemas.resolve(schema["items"])
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		values[i] = convert(item, schemaTypes(itemSchema))
+	}
+
+	return values, true
+}
+
+// convert parses the value as the first of the types it is valid for, otherwise it is left as a string to fail the schema
+func convert(value string, types []string) interface{} {
+	for _, t := range types {
+		switch t {
+		case "integer", "number":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				return f
+			}
+		case "boolean":
+			if value == "true" || value == "false" {
+				return value == "true"
+			}
+		case "string":
+			return value
+		}
+	}
+
+	return value
+}
+
+func hasType(types []string, t string) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBody checks the content type of the request body, and JSON bodies against the schema of the media type
+func (o *operations) validateBody(body map[string]interface{}, r *http.Request) []Violation {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		if body["required"] == true {
+			return []Violation{{In: "body", Message: "is required"}}
+		}
+		return nil
+	}
+
+	content, _ := body["content"].(map[string]interface{})
+	if len(content) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	media, ok := content[mediaType]
+	if !ok {
+		media, ok = content[strings.SplitN(mediaType, "/", 2)[0]+"/*"]
+	}
+	if !ok {
+		media, ok = content["*/*"]
+	}
+	if !ok {
+		return []Violation{{In: "header", Name: "Content-Type", Message: fmt.Sprintf("must be one of %s", strings.Join(sortedKeys(content), ", "))}}
+	}
+
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+
+	schema := asMap(media)["schema"]
+	if schema == nil {
+		return nil
+	}
+
+	// the body is read to validate it, so it is replaced with what was read followed by the rest of the body
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+	if err != nil || len(data) > maxBodySize {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return []Violation{{In: "body", Message: fmt.Sprintf("is not valid JSON: %v", err)}}
+	}
+
+	return o.schemas.validate(schema, value, "body", "")
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,149 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const petstore = `{
+	"openapi": "3.0.0",
+	"servers": [{"url": "/v1"}],
+	"paths": {
+		"/pets": {
+			"get": {
+				"parameters": [
+					{"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 100}},
+					{"name": "tags", "in": "query", "schema": {"type": "array", "items": {"type": "string", "enum": ["a", "b"]}}},
+					{"name": "X-Tenant", "in": "header", "required": true, "schema": {"type": "string"}}
+				]
+			},
+			"post": {
+				"requestBody": {
+					"required": true,
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}
+				}
+			}
+		},
+		"/pets/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+			"get": {}
+		},
+		"/pets/mine": {
+			"get": {}
+		}
+	},
+	"components": {
+		"schemas": {
+			"Pet": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}
+		}
+	}
+}`
+
+func TestValidateRequest(t *testing.T) {
+	target, _ := url.Parse("http://pets:8000/v1")
+	ops := compile(Source{Path: "/api/pets", Target: target}, parse(t, petstore))
+
+	tests := []struct {
+		method, target, contentType, body string
+		expected                          []string
+	}{
+		{"GET", "/api/pets/pets?limit=10&tags=a&tags=b", "", "", []string{"header X-Tenant is required"}},
+		{"GET", "/api/pets/pets?limit=ten", "", "", []string{"query limit must be integer, got string", "header X-Tenant is required"}},
+		{"GET", "/api/pets/pets?limit=500&tags=c", "", "", []string{"query limit must be at most 100", `query tags/0 must be one of "a", "b"`, "header X-Tenant is required"}},
+		{"GET", "/api/pets/pets/12", "", "", nil},
+		{"GET", "/api/pets/pets/twelve", "", "", []string{"path id must be integer, got string"}},
+		{"GET", "/api/pets/pets/mine", "", "", nil},
+		{"GET", "/api/pets/unknown", "", "", nil},
+		{"DELETE", "/api/pets/pets/12", "", "", nil},
+		{"POST", "/api/pets/pets", "application/json", `{"name": "rex"}`, nil},
+		{"POST", "/api/pets/pets", "application/json", `{"name": 1}`, []string{"body /name must be string, got integer"}},
+		{"POST", "/api/pets/pets", "application/json", `{`, []string{"body is not valid JSON: unexpected end of JSON input"}},
+		{"POST", "/api/pets/pets", "text/plain", `rex`, []string{"header Content-Type must be one of application/json"}},
+		{"POST", "/api/pets/pets", "", "", []string{"body is required"}},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+
+		var messages []string
+		for _, v := range ops.validate(r) {
+			messages = append(messages, v.String())
+		}
+
+		if !reflect.DeepEqual(messages, tt.expected) {
+			t.Errorf("%s %s: expected %q, got %q", tt.method, tt.target, tt.expected, messages)
+		}
+
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != tt.body {
+			t.Errorf("%s %s: expected the body to be passed on, got %q", tt.method, tt.target, body)
+		}
+	}
+}
+
+func TestValidateModes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(petstore))
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL + "/v1")
+
+	spec := New("1.0.0", 0)
+	defer spec.Close()
+	spec.Update([]Source{{Path: "/api/pets", Target: target, Spec: "/spec.json"}})
+	spec.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/spec", nil))
+
+	proxied := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+	})
+
+	rec := httptest.NewRecorder()
+	spec.Validate("/api/pets", ReportOnly, next).ServeHTTP(rec, httptest.NewRequest("GET", "/api/pets/pets/twelve", nil))
+	if rec.Code != http.StatusOK || proxied != 1 {
+		t.Errorf("expected report only to proxy the request, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	spec.Validate("/api/pets", Enforce, next).ServeHTTP(rec, httptest.NewRequest("GET", "/api/pets/pets/twelve", nil))
+	if rec.Code != http.StatusBadRequest || proxied != 1 || rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("expected enforce to reject the request, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var p problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid problem: %v", err)
+	}
+
+	expected := []Violation{{In: "path", Name: "id", Message: "must be integer, got string"}}
+	if p.Status != http.StatusBadRequest || p.Instance != "/api/pets/pets/twelve" || !reflect.DeepEqual(p.Violations, expected) {
+		t.Errorf("unexpected problem: %+v", p)
+	}
+
+	rec = httptest.NewRecorder()
+	spec.Validate("/api/other", Enforce, next).ServeHTTP(rec, httptest.NewRequest("GET", "/api/other/anything", nil))
+	if proxied != 2 {
+		t.Errorf("expected a service without a specification to be proxied, got %d", rec.Code)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for name, expected := range map[string]Mode{"": Off, "enforce": Enforce, "Report-Only": ReportOnly} {
+		if mode, err := ParseMode(name); err != nil || mode != expected {
+			t.Errorf("%q: expected %q, got %q %v", name, expected, mode, err)
+		}
+	}
+
+	if _, err := ParseMode("strict"); err == nil {
+		t.Errorf("expected an unknown mode to fail")
+	}
+}
@@ -1,6 +1,18 @@
 package server
 
-import "github.com/renevo/gateway/server/static"
+import (
+	"strings"
+	"time"
+
+	"github.com/renevo/gateway/metrics"
+	"github.com/renevo/gateway/server/cors"
+	"github.com/renevo/gateway/server/headers"
+	"github.com/renevo/gateway/server/openapi"
+	"github.com/renevo/gateway/server/proxy"
+	"github.com/renevo/gateway/server/realip"
+	"github.com/renevo/gateway/server/static"
+	"github.com/renevo/gateway/tracing"
+)
 
 type Option func(*Server)
 
@@ -9,3 +21,80 @@ func MountSite(path string) Option {
 		s.site = static.New(path)
 	}
 }
+
+// ErrorPages sets the custom error pages keyed by status code or wildcard (4xx, 5xx, error)
+func ErrorPages(pages map[string]string) Option {
+	return func(s *Server) {
+		s.errorPages = pages
+	}
+}
+
+// ContentTimeout overrides the listener read and write timeouts for static content requests
+func ContentTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.contentTimeout = timeout
+	}
+}
+
+// CORS applies the cross origin resource sharing policy to the site and all services
+func CORS(policy *cors.Policy) Option {
+	return func(s *Server) {
+		s.cors = policy
+	}
+}
+
+// Headers applies the response header policy to every response
+func Headers(policy *headers.Policy) Option {
+	return func(s *Server) {
+		s.headers = policy
+	}
+}
+
+// RequestID forwards the request id to the backend services, trust will accept a valid request id sent by the client
+func RequestID(forward, trust bool) Option {
+	return func(s *Server) {
+		s.forwardRequestID = forward
+		s.trustRequestID = trust
+	}
+}
+
+// RealIP resolves the client address of every request, when logged it replaces the connecting address in the access log
+func RealIP(resolver *realip.Resolver, logged bool) Option {
+	return func(s *Server) {
+		s.realIP = resolver
+		s.logRealIP = logged
+	}
+}
+
+// Metrics records every completed request
+func Metrics(recorders ...metrics.Recorder) Option {
+	return func(s *Server) {
+		s.metrics = append(s.metrics, recorders...)
+	}
+}
+
+// Tracing starts a span for every request, continuing the trace of the client when it sends a traceparent
+func Tracing(tracer *tracing.Tracer) Option {
+	return func(s *Server) {
+		s.tracer = tracer
+	}
+}
+
+// OpenAPI serves the merged OpenAPI specification of the services at path (and path.json, path.yaml)
+//
+// When uiPath is not empty, the Swagger UI in that directory is served to browsers at path/. When path is empty the
+// specification isn't served, it is only used to validate requests to the services.
+func OpenAPI(path, uiPath string, spec *openapi.Spec) Option {
+	return func(s *Server) {
+		s.specPath = strings.TrimSuffix(path, "/")
+		s.specUI = uiPath
+		s.spec = spec
+	}
+}
+
+// MountService will proxy all requests under the service path to the backend service
+func MountService(service *proxy.Service) Option {
+	return func(s *Server) {
+		s.services = append(s.services, service)
+	}
+}
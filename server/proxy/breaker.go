@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+)
+
+// State is the current state of a circuit breaker
+type State int
+
+const (
+	// StateClosed allows all requests through to the backend
+	StateClosed State = iota
+	// StateOpen fails all requests without contacting the backend
+	StateOpen
+	// StateHalfOpen allows a single trial request through to decide if the breaker should close
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// BreakerStats is a point in time snapshot of a circuit breaker
+type BreakerStats struct {
+	State       State
+	Transitions map[State]uint64
+	Rejected    uint64
+}
+
+// Breaker is a circuit breaker for a single backend service
+type Breaker struct {
+	name     string
+	ratio    float64
+	minimum  int
+	window   time.Duration
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       State
+	windowStart time.Time
+	openedAt    time.Time
+	requests    int
+	failures    int
+	probing     bool
+	transitions map[State]uint64
+	rejected    uint64
+}
+
+// NewBreaker creates a closed circuit breaker
+//
+// The breaker will open once at least minimum requests have been seen within the window and the ratio of failures
+// meets or exceeds ratio. After cooldown a single trial request is allowed through.
+func NewBreaker(name string, ratio float64, minimum int, window, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		name:        name,
+		ratio:       ratio,
+		minimum:     minimum,
+		window:      window,
+		cooldown:    cooldown,
+		now:         time.Now,
+		transitions: make(map[State]uint64),
+	}
+}
+
+// Allow returns true when a request should be sent to the backend
+//
+// Every allowed request must be followed by a call to Success, Failure or Release
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			b.rejected++
+			return false
+		}
+		b.transition(StateHalfOpen)
+		b.probing = true
+		return true
+
+	case StateHalfOpen:
+		if b.probing {
+			b.rejected++
+			return false
+		}
+		b.probing = true
+		return true
+	}
+
+	if b.window > 0 && now.Sub(b.windowStart) >= b.window {
+		b.reset(now)
+	}
+
+	return true
+}
+
+// Success records a successful backend request
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.transition(StateClosed)
+		b.reset(b.now())
+		return
+	}
+
+	b.requests++
+}
+
+// Failure records a failed backend request
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.open()
+		return
+	}
+
+	b.requests++
+	b.failures++
+
+	if b.state == StateClosed && b.requests >= b.minimum && float64(b.failures)/float64(b.requests) >= b.ratio {
+		b.open()
+	}
+}
+
+// Release records a request that ended before the backend answered (e.g. canceled by the client), it is neither a
+// success nor a failure, so a half-open breaker allows another trial request
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.probing = false
+	}
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Stats returns a snapshot of the breaker counters
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BreakerStats{
+		State:       b.state,
+		Transitions: make(map[State]uint64, len(b.transitions)),
+		Rejected:    b.rejected,
+	}
+
+	for state, count := range b.transitions {
+		stats.Transitions[state] = count
+	}
+
+	return stats
+}
+
+func (b *Breaker) open() {
+	b.transition(StateOpen)
+	b.openedAt = b.now()
+	b.probing = false
+}
+
+func (b *Breaker) reset(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *Breaker) transition(to State) {
+	if b.state == to {
+		return
+	}
+
+	if to == StateOpen {
+		logging.Errorf("Circuit breaker %s: %s -> %s", b.name, b.state, to)
+	} else {
+		logging.Infof("Circuit breaker %s: %s -> %s", b.name, b.state, to)
+	}
+
+	b.state = to
+	b.transitions[to]++
+}
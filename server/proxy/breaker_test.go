@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker("/api/test", 0.5, 4, time.Minute, time.Second*30)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("closed breaker rejected request %d", i)
+		}
+		b.Success()
+	}
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("closed breaker rejected request %d", i)
+		}
+		b.Failure()
+	}
+
+	if b.State() != StateOpen {
+		t.Fatalf("expected breaker to be open after 2/4 failures, got %s", b.State())
+	}
+
+	if b.Allow() {
+		t.Errorf("open breaker allowed a request before cooldown")
+	}
+
+	now = now.Add(time.Second * 30)
+
+	if !b.Allow() {
+		t.Fatalf("breaker did not allow a trial request after cooldown")
+	}
+
+	if b.State() != StateHalfOpen {
+		t.Fatalf("expected breaker to be half-open, got %s", b.State())
+	}
+
+	if b.Allow() {
+		t.Errorf("half-open breaker allowed more than one trial request")
+	}
+
+	b.Failure()
+	if b.State() != StateOpen {
+		t.Fatalf("expected failed trial to re-open the breaker, got %s", b.State())
+	}
+
+	now = now.Add(time.Second * 30)
+	b.Allow()
+	b.Success()
+
+	if b.State() != StateClosed {
+		t.Fatalf("expected successful trial to close the breaker, got %s", b.State())
+	}
+
+	stats := b.Stats()
+	if stats.Transitions[StateOpen] != 2 || stats.Transitions[StateHalfOpen] != 2 || stats.Transitions[StateClosed] != 1 {
+		t.Errorf("unexpected transition counts: %v", stats.Transitions)
+	}
+
+	if stats.Rejected != 2 {
+		t.Errorf("expected 2 rejected requests, got %d", stats.Rejected)
+	}
+}
+
+func TestBreakerReleasedTrial(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker("/api/test", 0.5, 1, time.Minute, time.Second*30)
+	b.now = func() time.Time { return now }
+
+	b.Allow()
+	b.Failure()
+
+	now = now.Add(time.Second * 30)
+	if !b.Allow() {
+		t.Fatalf("breaker did not allow a trial request after cooldown")
+	}
+
+	b.Release()
+	if b.State() != StateHalfOpen {
+		t.Fatalf("expected a released trial to leave the breaker half-open, got %s", b.State())
+	}
+
+	if !b.Allow() {
+		t.Errorf("expected another trial request after the trial was released")
+	}
+}
+
+func TestBreakerMinimumRequests(t *testing.T) {
+	b := NewBreaker("/api/test", 0.5, 10, time.Minute, time.Minute)
+
+	for i := 0; i < 9; i++ {
+		b.Allow()
+		b.Failure()
+	}
+
+	if b.State() != StateClosed {
+		t.Errorf("breaker opened before the minimum number of requests")
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/renevo/gateway/dns"
+	"github.com/renevo/gateway/server/cors"
+	"github.com/renevo/gateway/server/openapi"
+)
+
+// Option configures a backend service proxy
+type Option func(*Service)
+
+// Retry sets how many times, how often, and for how long connection failures to the backend are retried
+//
+// A count of -1 will retry until the timeout has elapsed
+func Retry(count int, delay, timeout time.Duration) Option {
+	return func(s *Service) {
+		s.retry.count = count
+		s.retry.delay = delay
+		s.retry.timeout = timeout
+	}
+}
+
+// CircuitBreaker enables a circuit breaker for the backend service
+func CircuitBreaker(ratio float64, minimum int, window, cooldown time.Duration) Option {
+	return func(s *Service) {
+		s.breaker = NewBreaker(s.path, ratio, minimum, window, cooldown)
+	}
+}
+
+// Timeouts sets how long to wait for a connection and a response from the backend service
+func Timeouts(connect, read time.Duration) Option {
+	return func(s *Service) {
+		s.connectTimeout = connect
+		s.readTimeout = read
+	}
+}
+
+// Resolver sets a custom DNS resolver used to connect to the backend service
+func Resolver(resolver *dns.Resolver) Option {
+	return func(s *Service) {
+		s.resolver = resolver
+	}
+}
+
+// IdleTimeout sets how long an upgraded connection (e.g. WebSocket) may go without traffic before it is closed
+func IdleTimeout(idle time.Duration) Option {
+	return func(s *Service) {
+		if idle > 0 {
+			s.idleTimeout = idle
+		}
+	}
+}
+
+// CORS overrides the site cross origin resource sharing policy for the service
+func CORS(policy *cors.Policy) Option {
+	return func(s *Service) {
+		s.cors = policy
+	}
+}
+
+// Spec sets where the OpenAPI specification of the service is, a path on the backend service or an absolute URL
+func Spec(spec string) Option {
+	return func(s *Service) {
+		s.spec = spec
+	}
+}
+
+// Validate sets how requests that don't match the OpenAPI specification of the service are handled
+func Validate(mode openapi.Mode) Option {
+	return func(s *Service) {
+		s.validation = mode
+	}
+}
@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/renevo/gateway/dns"
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/server/cors"
+	"github.com/renevo/gateway/server/headers"
+	"github.com/renevo/gateway/server/openapi"
+	"github.com/renevo/gateway/tracing"
+)
+
+// ErrorHandler writes a gateway generated error response to the client
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, code int)
+
+// Service is a reverse proxy to a single backend service
+type Service struct {
+	path           string
+	target         *url.URL
+	handler        *httputil.ReverseProxy
+	transport      *http.Transport
+	retry          *retryTransport
+	breaker        *Breaker
+	errorHandler   ErrorHandler
+	resolver       *dns.Resolver
+	cors           *cors.Policy
+	spec           string
+	validation     openapi.Mode
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	idleTimeout    time.Duration
+
+	tunnelsMu sync.Mutex
+	tunnels   map[*tunnel]struct{}
+}
+
+type outcomeKey struct{}
+
+// outcome tracks if the backend failed, or the client canceled, while proxying a single request
+type outcome struct {
+	failed   bool
+	canceled bool
+}
+
+// New creates a new backend service proxy mounted at path
+//
+// When the target has a path, the mounted path will be replaced with the target path, otherwise requests are passed through as is
+func New(path string, target *url.URL, options ...Option) *Service {
+	s := &Service{
+		path:        path,
+		target:      target,
+		idleTimeout: defaultIdleTimeout,
+		tunnels:     make(map[*tunnel]struct{}),
+		errorHandler: func(w http.ResponseWriter, r *http.Request, code int) {
+			http.Error(w, http.StatusText(code), code)
+		},
+	}
+
+	s.transport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	s.retry = &retryTransport{
+		inner: s.transport,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   s.connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	s.transport.DialContext = dialer.DialContext
+	if s.resolver != nil {
+		// without a port, the resolver will find the port from the SRV record
+		s.transport.DialContext = s.resolver.DialContext(dialer, target.Port() == "")
+	}
+	s.transport.ResponseHeaderTimeout = s.readTimeout
+
+	s.handler = &httputil.ReverseProxy{
+		Rewrite:        s.rewrite,
+		Transport:      s.retry,
+		ModifyResponse: s.modifyResponse,
+		ErrorHandler:   s.proxyError,
+	}
+
+	return s
+}
+
+// Path returns the path the service is mounted at
+func (s *Service) Path() string {
+	return s.path
+}
+
+// Target returns the backend service address
+func (s *Service) Target() *url.URL {
+	return s.target
+}
+
+// CORS returns the cross origin resource sharing policy for the service, or nil to use the site policy
+func (s *Service) CORS() *cors.Policy {
+	return s.cors
+}
+
+// ReadTimeout returns how long a request to the service may take before giving up, zero when unlimited
+func (s *Service) ReadTimeout() time.Duration {
+	return s.readTimeout
+}
+
+// Breaker returns the circuit breaker for the service, or nil when disabled
+func (s *Service) Breaker() *Breaker {
+	return s.breaker
+}
+
+// Retries returns how many times connecting to the backend has been retried
+func (s *Service) Retries() uint64 {
+	return atomic.LoadUint64(&s.retry.retries)
+}
+
+// Spec returns where the OpenAPI specification of the service is, empty when it has none
+func (s *Service) Spec() string {
+	return s.spec
+}
+
+// Validation returns how requests that don't match the OpenAPI specification of the service are handled
+func (s *Service) Validation() openapi.Mode {
+	return s.validation
+}
+
+// Transport returns the transport used to connect to the backend service, without retries
+func (s *Service) Transport() http.RoundTripper {
+	return s.transport
+}
+
+// HandleErrors sets the handler used to write gateway generated error responses
+func (s *Service) HandleErrors(handler ErrorHandler) {
+	s.errorHandler = handler
+}
+
+// ServeHTTP is the HTTP handler for proxying to the backend service
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.breaker != nil && !s.breaker.Allow() {
+		logging.FromContext(r.Context()).Debugf("Circuit breaker %s is open, failing %s %s", s.path, r.Method, r.URL)
+		s.errorHandler(w, r, http.StatusServiceUnavailable)
+		return
+	}
+
+	result := &outcome{}
+	r = r.WithContext(context.WithValue(r.Context(), outcomeKey{}, result))
+
+	if isUpgrade(r) {
+		s.serveUpgrade(w, r)
+	} else {
+		s.handler.ServeHTTP(&streamWriter{ResponseWriter: w}, r)
+	}
+
+	if s.breaker == nil {
+		return
+	}
+
+	switch {
+	case result.canceled:
+		s.breaker.Release()
+	case result.failed:
+		s.breaker.Failure()
+	default:
+		s.breaker.Success()
+	}
+}
+
+func (s *Service) rewrite(pr *httputil.ProxyRequest) {
+	s.direct(pr.Out, pr.In)
+}
+
+// direct points the outgoing request r at the backend service
+func (s *Service) direct(r, in *http.Request) {
+	r.URL.Scheme = s.target.Scheme
+	r.URL.Host = s.target.Host
+
+	if s.target.Path != "" {
+		r.URL.Path = joinPath(s.target.Path, strings.TrimPrefix(r.URL.Path, s.path))
+		r.URL.RawPath = ""
+	}
+
+	if s.target.RawQuery != "" {
+		if r.URL.RawQuery == "" {
+			r.URL.RawQuery = s.target.RawQuery
+		} else {
+			r.URL.RawQuery = s.target.RawQuery + "&" + r.URL.RawQuery
+		}
+	}
+
+	headers.SetRemoteURL(r.Context(), r.URL.String())
+	forward(r, in)
+	tracing.FromContext(in.Context()).Inject(r.Header)
+
+	if _, ok := r.Header["User-Agent"]; !ok {
+		// explicitly disable User-Agent so it's not set to default value
+		r.Header.Set("User-Agent", "")
+	}
+}
+
+// forward describes the client request in the X-Forwarded-* and Forwarded headers, extending any chain sent by a trusted proxy
+//
+// Forwarding headers from untrusted clients have already been removed when the client address was resolved.
+func forward(r, in *http.Request) {
+	client, _, err := net.SplitHostPort(in.RemoteAddr)
+	if err != nil {
+		client = in.RemoteAddr
+	}
+
+	proto := "http"
+	if in.TLS != nil {
+		proto = "https"
+	}
+
+	if prior := in.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+		r.Header.Set("X-Forwarded-For", strings.Join(prior, ", ")+", "+client)
+	} else {
+		r.Header.Set("X-Forwarded-For", client)
+	}
+
+	if host := in.Header.Get("X-Forwarded-Host"); host != "" {
+		r.Header.Set("X-Forwarded-Host", host)
+	} else {
+		r.Header.Set("X-Forwarded-Host", in.Host)
+	}
+
+	if prior := in.Header.Get("X-Forwarded-Proto"); prior != "" {
+		r.Header.Set("X-Forwarded-Proto", prior)
+	} else {
+		r.Header.Set("X-Forwarded-Proto", proto)
+	}
+
+	node := client
+	if strings.Contains(node, ":") {
+		node = `"[` + node + `]"`
+	}
+
+	element := fmt.Sprintf("for=%s;host=%q;proto=%s", node, in.Host, proto)
+	if prior := in.Header.Values("Forwarded"); len(prior) > 0 {
+		element = strings.Join(prior, ", ") + ", " + element
+	}
+	r.Header.Set("Forwarded", element)
+}
+
+func (s *Service) modifyResponse(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		fail(res.Request.Context())
+	}
+
+	return nil
+}
+
+func (s *Service) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() == context.Canceled {
+		logging.FromContext(r.Context()).Debugf("Client canceled request %s %s: %v", r.Method, r.URL, err)
+		if result, ok := r.Context().Value(outcomeKey{}).(*outcome); ok {
+			result.canceled = true
+		}
+		return
+	}
+
+	fail(r.Context())
+
+	code := http.StatusBadGateway
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() || r.Context().Err() == context.DeadlineExceeded {
+		code = http.StatusGatewayTimeout
+	}
+
+	logging.FromContext(r.Context()).Errorf("Backend %s failed for %s %s: %v", s.path, r.Method, r.URL, err)
+	s.errorHandler(w, r, code)
+}
+
+func fail(ctx context.Context) {
+	if result, ok := ctx.Value(outcomeKey{}).(*outcome); ok {
+		result.failed = true
+	}
+}
+
+func joinPath(base, p string) string {
+	if p == "" || p == "/" {
+		return base
+	}
+
+	joined := path.Join(base, p)
+	if strings.HasSuffix(p, "/") {
+		joined += "/"
+	}
+
+	return joined
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	service := New("/api", target)
+
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.org/api/test", nil)
+	r.RemoteAddr = "10.0.0.2:4711"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("Forwarded", "for=203.0.113.7;proto=https")
+
+	w := httptest.NewRecorder()
+	service.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	expected := map[string]string{
+		"X-Forwarded-For":   "203.0.113.7, 10.0.0.2",
+		"X-Forwarded-Host":  "api.example.org",
+		"X-Forwarded-Proto": "https",
+		"Forwarded":         `for=203.0.113.7;proto=https, for=10.0.0.2;host="api.example.org";proto=http`,
+	}
+
+	for header, value := range expected {
+		if actual := received.Get(header); actual != value {
+			t.Errorf("expected %s: %q, got %q", header, value, actual)
+		}
+	}
+}
+
+func TestCanceledTrialLeavesBreakerHalfOpen(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	service := New("/api", target, CircuitBreaker(0.5, 1, time.Minute, time.Second))
+
+	now := time.Now()
+	breaker := service.Breaker()
+	breaker.now = func() time.Time { return now }
+	breaker.Allow()
+	breaker.Failure()
+	now = now.Add(time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.org/api/test", nil).WithContext(ctx)
+	service.ServeHTTP(httptest.NewRecorder(), r)
+
+	if state := breaker.State(); state != StateHalfOpen {
+		t.Errorf("expected a canceled trial to leave the breaker half-open, got %s", state)
+	}
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/tracing"
+)
+
+// retryTransport will retry requests that failed to connect to the backend
+//
+// Only connection failures are retried, once a request has been sent it is never replayed.
+type retryTransport struct {
+	inner   http.RoundTripper
+	count   int
+	delay   time.Duration
+	timeout time.Duration
+	retries uint64
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body *retryBody
+	if req.Body != nil && req.Body != http.NoBody {
+		body = &retryBody{ReadCloser: req.Body}
+		req.Body = body
+	}
+
+	deadline := time.Now().Add(t.timeout)
+
+	for attempt := 0; ; attempt++ {
+		res, err := t.roundTrip(req, attempt)
+		if err == nil || (body != nil && body.read) || !t.retry(req.Context(), attempt, deadline, err) {
+			return res, err
+		}
+	}
+}
+
+// roundTrip makes a single attempt, traced as a child of the request span with the DNS lookup and connect timings
+func (t *retryTransport) roundTrip(req *http.Request, attempt int) (*http.Response, error) {
+	span := tracing.FromContext(req.Context()).Child(req.Method, tracing.KindClient)
+	if span == nil {
+		return t.inner.RoundTrip(req)
+	}
+
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.String())
+	span.SetAttribute("server.address", req.URL.Host)
+	if attempt > 0 {
+		span.SetAttribute("http.request.resend_count", attempt)
+	}
+
+	// dual stack hosts are dialed in parallel, so the connections are tracked by address
+	var mu sync.Mutex
+	var dns *tracing.Span
+	connects := make(map[string]*tracing.Span)
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			dns = span.Child("dns "+info.Host, tracing.KindInternal)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				dns.Fail(info.Err.Error())
+			}
+			dns.End()
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connects[addr] = span.Child("connect "+addr, tracing.KindInternal)
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			connect := connects[addr]
+			mu.Unlock()
+
+			if err != nil {
+				connect.Fail(err.Error())
+			}
+			connect.End()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.SetAttribute("gateway.connection_reused", info.Reused)
+		},
+	}
+
+	out := req.Clone(httptrace.WithClientTrace(req.Context(), trace))
+	span.Inject(out.Header)
+
+	res, err := t.inner.RoundTrip(out)
+	if err != nil {
+		span.Fail(err.Error())
+	} else {
+		span.SetAttribute("http.response.status_code", res.StatusCode)
+		if res.StatusCode >= 500 {
+			span.Fail(res.Status)
+		}
+	}
+	span.End()
+
+	return res, err
+}
+
+// retry will wait for the retry delay and return true when another attempt should be made after err
+func (t *retryTransport) retry(ctx context.Context, attempt int, deadline time.Time, err error) bool {
+	if !isConnectError(err) {
+		return false
+	}
+
+	if t.count >= 0 && attempt >= t.count {
+		return false
+	}
+
+	if t.timeout > 0 && time.Now().Add(t.delay).After(deadline) {
+		return false
+	}
+
+	logging.FromContext(ctx).Debugf("Retrying connection after failure (attempt %d): %v", attempt+1, err)
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(t.delay):
+		atomic.AddUint64(&t.retries, 1)
+		return true
+	}
+}
+
+// isConnectError returns true when the backend could not be reached, including failures to resolve its address
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) && opErr.Op == "dial" || errors.As(err, &dnsErr)
+}
+
+// retryBody keeps the request body open between attempts so that it can be sent once a connection succeeds
+//
+// The inbound request body is closed by the http server once the handler has returned
+type retryBody struct {
+	io.ReadCloser
+	read bool
+}
+
+func (b *retryBody) Read(p []byte) (int, error) {
+	b.read = true
+	return b.ReadCloser.Read(p)
+}
+
+func (b *retryBody) Close() error {
+	return nil
+}
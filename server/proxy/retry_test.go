@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRetryAfterDNSError(t *testing.T) {
+	attempts := 0
+	transport := &retryTransport{
+		count: 1,
+		inner: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if attempts++; attempts == 1 {
+				return nil, &net.DNSError{Err: "no such host", Name: "test.service.consul", IsNotFound: true}
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+	}
+
+	res, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://test.service.consul/", nil))
+	if err != nil {
+		t.Fatalf("expected the lookup failure to be retried, got %v", err)
+	}
+	res.Body.Close()
+
+	if attempts != 2 || transport.retries != 1 {
+		t.Errorf("expected 2 attempts and 1 retry, got %d attempts and %d retries", attempts, transport.retries)
+	}
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// streamWriter flushes server-sent events to the client as soon as each event is complete
+//
+// Any other response is passed through untouched, the reverse proxy already flushes responses without a content length.
+type streamWriter struct {
+	http.ResponseWriter
+	events  bool
+	newline bool
+}
+
+func isEventStream(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+func (w *streamWriter) WriteHeader(code int) {
+	if code >= http.StatusOK && isEventStream(w.Header()) {
+		w.events = true
+
+		// event streams are long lived, so they are not bound by the route write deadline
+		http.NewResponseController(w.ResponseWriter).SetWriteDeadline(time.Time{})
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	if err != nil || !w.events || n == 0 {
+		return n, err
+	}
+
+	// an event ends with a blank line, which may be split across writes
+	complete := bytes.Contains(p, []byte("\n\n")) || bytes.Contains(p, []byte("\r\n\r\n")) || (w.newline && (p[0] == '\n' || bytes.HasPrefix(p, []byte("\r\n"))))
+	w.newline = p[n-1] == '\n'
+
+	if complete {
+		w.flush()
+	}
+
+	return n, err
+}
+
+// Flush is ignored for event streams until an event is complete
+func (w *streamWriter) Flush() {
+	if w.events {
+		return
+	}
+
+	w.flush()
+}
+
+func (w *streamWriter) flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *streamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
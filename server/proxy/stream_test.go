@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestEventStreamFlushesEachEvent(t *testing.T) {
+	release := make(chan struct{})
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: one\n\n"))
+		w.(http.Flusher).Flush()
+
+		// keep the stream open so only a flush can deliver the event
+		<-release
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	front := httptest.NewServer(New("/events", target))
+	defer front.Close()
+
+	res, err := http.Get(front.URL + "/events")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	defer close(release)
+
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(res.Body).ReadString('\n')
+		lines <- line
+	}()
+
+	select {
+	case line := <-lines:
+		if line != "data: one\n" {
+			t.Errorf("unexpected event line %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("event was not flushed to the client")
+	}
+}
@@ -0,0 +1,273 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+)
+
+const defaultIdleTimeout = time.Minute * 5
+
+// tunnel is an upgraded connection between a client and the backend service
+type tunnel struct {
+	client   net.Conn
+	backend  net.Conn
+	idle     time.Duration
+	activity int64
+	once     sync.Once
+}
+
+func isUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && r.Header.Get("Upgrade") != ""
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h[http.CanonicalHeaderKey(name)] {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// serveUpgrade forwards the upgrade request to the backend, and when accepted tunnels the connection
+func (s *Service) serveUpgrade(w http.ResponseWriter, r *http.Request) {
+	upgrade := r.Header.Get("Upgrade")
+
+	outreq := r.Clone(r.Context())
+	outreq.RequestURI = ""
+	s.direct(outreq, r)
+	outreq.Header.Set("Connection", "Upgrade")
+	outreq.Header.Set("Upgrade", upgrade)
+
+	backend, err := s.dialBackend(r.Context())
+	if err != nil {
+		s.proxyError(w, r, err)
+		return
+	}
+
+	if deadline, ok := r.Context().Deadline(); ok {
+		backend.SetDeadline(deadline)
+	} else if s.readTimeout > 0 {
+		backend.SetDeadline(time.Now().Add(s.readTimeout))
+	}
+
+	if err := outreq.Write(backend); err != nil {
+		backend.Close()
+		s.proxyError(w, r, err)
+		return
+	}
+
+	backendReader := bufio.NewReader(backend)
+	res, err := http.ReadResponse(backendReader, outreq)
+	if err != nil {
+		backend.Close()
+		s.proxyError(w, r, err)
+		return
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols || !strings.EqualFold(res.Header.Get("Upgrade"), upgrade) {
+		// the backend declined the upgrade, so relay the response as is
+		defer backend.Close()
+		defer res.Body.Close()
+
+		for key, values := range res.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+
+		s.modifyResponse(res)
+		return
+	}
+
+	client, clientBuffer, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		backend.Close()
+		logging.FromContext(r.Context()).Errorf("Failed to hijack connection for %s upgrade: %v", upgrade, err)
+		s.errorHandler(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	// the server deadlines no longer apply once the connection belongs to the tunnel
+	client.SetDeadline(time.Time{})
+	backend.SetDeadline(time.Time{})
+
+	if err := res.Write(clientBuffer); err != nil || clientBuffer.Flush() != nil {
+		client.Close()
+		backend.Close()
+		return
+	}
+
+	t := &tunnel{
+		client:  client,
+		backend: backend,
+		idle:    s.idleTimeout,
+	}
+
+	log := logging.FromContext(r.Context())
+	s.track(t, true)
+	log.Debugf("Upgraded %s %s to %s", r.Method, r.URL, upgrade)
+
+	go func() {
+		defer s.track(t, false)
+		t.run(clientBuffer.Reader, backendReader)
+		log.Debugf("Closed %s tunnel for %s", upgrade, r.URL)
+	}()
+}
+
+func (s *Service) dialBackend(ctx context.Context) (net.Conn, error) {
+	address := s.target.Host
+	if s.target.Port() == "" {
+		port := "80"
+		if s.target.Scheme == "https" || s.target.Scheme == "wss" {
+			port = "443"
+		}
+		address = net.JoinHostPort(s.target.Hostname(), port)
+	}
+
+	deadline := time.Now().Add(s.retry.timeout)
+
+	for attempt := 0; ; attempt++ {
+		conn, err := s.transport.DialContext(ctx, "tcp", address)
+		if err == nil {
+			if s.target.Scheme == "https" || s.target.Scheme == "wss" {
+				return s.handshake(ctx, conn)
+			}
+			return conn, nil
+		}
+
+		if !s.retry.retry(ctx, attempt, deadline, err) {
+			return nil, err
+		}
+	}
+}
+
+func (s *Service) handshake(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	cfg := &tls.Config{}
+	if s.transport.TLSClientConfig != nil {
+		cfg = s.transport.TLSClientConfig.Clone()
+	}
+
+	if cfg.ServerName == "" {
+		cfg.ServerName = s.target.Hostname()
+	}
+	cfg.NextProtos = []string{"http/1.1"}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+func (s *Service) track(t *tunnel, add bool) {
+	s.tunnelsMu.Lock()
+	defer s.tunnelsMu.Unlock()
+
+	if add {
+		s.tunnels[t] = struct{}{}
+	} else {
+		delete(s.tunnels, t)
+	}
+}
+
+// Shutdown closes all of the upgraded connections, waiting for them to finish until the context is done
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.tunnelsMu.Lock()
+	for t := range s.tunnels {
+		t.close()
+	}
+	s.tunnelsMu.Unlock()
+
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+
+	for {
+		s.tunnelsMu.Lock()
+		remaining := len(s.tunnels)
+		s.tunnelsMu.Unlock()
+
+		if remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// run copies data in both directions until either side closes or the tunnel has been idle too long
+func (t *tunnel) run(clientBuffered, backendBuffered io.Reader) {
+	defer t.close()
+
+	t.touch()
+
+	done := make(chan struct{}, 2)
+	go t.copy(t.backend, t.client, clientBuffered, done)
+	go t.copy(t.client, t.backend, backendBuffered, done)
+
+	<-done
+}
+
+func (t *tunnel) copy(dst, src net.Conn, buffered io.Reader, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+
+	buf := make([]byte, 32*1024)
+	for {
+		if t.idle > 0 {
+			src.SetReadDeadline(time.Now().Add(t.idle))
+		}
+
+		n, err := buffered.Read(buf)
+		if n > 0 {
+			t.touch()
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() && !t.expired() {
+			// the other direction is still active
+			continue
+		}
+
+		return
+	}
+}
+
+func (t *tunnel) touch() {
+	atomic.StoreInt64(&t.activity, time.Now().UnixNano())
+}
+
+func (t *tunnel) expired() bool {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.activity))) >= t.idle
+}
+
+func (t *tunnel) close() {
+	t.once.Do(func() {
+		t.client.Close()
+		t.backend.Close()
+	})
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// echoUpgrade accepts an "echo" upgrade and writes back everything it reads
+func echoUpgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") != "echo" {
+		http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+	buf.Flush()
+
+	io.Copy(conn, buf)
+}
+
+func TestUpgradeOutlivesWriteTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(echoUpgrade))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	service := New("/ws", target)
+
+	front := httptest.NewUnstartedServer(service)
+	front.Config.WriteTimeout = time.Millisecond * 100
+	front.Start()
+	defer front.Close()
+
+	conn, err := net.Dial("tcp", front.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.org\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("failed to read upgrade response: %v", err)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101 response, got %d", res.StatusCode)
+	}
+
+	// wait past the server write timeout before using the tunnel
+	time.Sleep(time.Millisecond * 200)
+
+	conn.Write([]byte("ping"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	echo := make([]byte, 4)
+	if _, err := io.ReadFull(reader, echo); err != nil || string(echo) != "ping" {
+		t.Fatalf("expected ping to be echoed, got %q: %v", echo, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := service.Shutdown(ctx); err != nil {
+		t.Fatalf("failed to shutdown tunnels: %v", err)
+	}
+
+	if _, err := reader.ReadByte(); err == nil {
+		t.Errorf("expected tunnel to be closed after shutdown")
+	}
+}
+
+func TestUpgradeDeclined(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(echoUpgrade))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	front := httptest.NewServer(New("/ws", target))
+	defer front.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("expected the backend response to be relayed, got %d", res.StatusCode)
+	}
+}
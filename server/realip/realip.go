@@ -0,0 +1,160 @@
+package realip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardingHeaders are only accepted from trusted proxies
+var forwardingHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-IP"}
+
+type contextKey struct{}
+
+// Resolver finds the client address of requests that passed through trusted proxies
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// New creates a resolver trusting the forwarding headers sent by the proxies, given as addresses or CIDR ranges
+func New(trusted []string) (*Resolver, error) {
+	res := &Resolver{}
+
+	for _, proxy := range trusted {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", proxy)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			res.trusted = append(res.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %v", proxy, err)
+		}
+		res.trusted = append(res.trusted, network)
+	}
+
+	return res, nil
+}
+
+// Trusted returns true when the forwarding headers sent by ip are accepted
+func (res *Resolver) Trusted(ip net.IP) bool {
+	if res == nil || ip == nil {
+		return false
+	}
+
+	for _, network := range res.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve returns the request with the client address in its context
+//
+// The forwarded chain is walked from the nearest proxy back until an address that is not trusted is found. Forwarding headers
+// sent by an untrusted peer are removed, so the chain passed on to the backends only contains trusted entries.
+func (res *Resolver) Resolve(r *http.Request) *http.Request {
+	peer := parseIP(r.RemoteAddr)
+	client := peer
+
+	if res.Trusted(peer) {
+		chain := forwardedChain(r.Header)
+		for i := len(chain) - 1; i >= 0 && res.Trusted(client); i-- {
+			if chain[i] == nil {
+				break
+			}
+			client = chain[i]
+		}
+	} else {
+		for _, header := range forwardingHeaders {
+			r.Header.Del(header)
+		}
+	}
+
+	address := r.RemoteAddr
+	if client != nil {
+		address = client.String()
+	}
+
+	return r.WithContext(NewContext(r.Context(), address))
+}
+
+// NewContext returns a context carrying the client address
+func NewContext(ctx context.Context, address string) context.Context {
+	return context.WithValue(ctx, contextKey{}, address)
+}
+
+// FromContext returns the client address of the context, or an empty string
+func FromContext(ctx context.Context) string {
+	address, _ := ctx.Value(contextKey{}).(string)
+	return address
+}
+
+// forwardedChain returns the client addresses recorded by proxies, preferring Forwarded over X-Forwarded-For over X-Real-IP
+//
+// Entries that are not addresses (e.g. unknown or obfuscated identifiers) are nil.
+func forwardedChain(h http.Header) []net.IP {
+	var chain []net.IP
+
+	if values := h["Forwarded"]; len(values) > 0 {
+		for _, element := range splitList(values) {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					chain = append(chain, parseIP(strings.Trim(kv[1], `"`)))
+				}
+			}
+		}
+		return chain
+	}
+
+	if values := h["X-Forwarded-For"]; len(values) > 0 {
+		for _, address := range splitList(values) {
+			chain = append(chain, parseIP(address))
+		}
+		return chain
+	}
+
+	if address := h.Get("X-Real-IP"); address != "" {
+		chain = append(chain, parseIP(address))
+	}
+
+	return chain
+}
+
+// parseIP parses an address with an optional port, IPv6 addresses with a port are in brackets
+func parseIP(address string) net.IP {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+
+	return net.ParseIP(strings.Trim(address, "[]"))
+}
+
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
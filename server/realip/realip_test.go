@@ -0,0 +1,64 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	res, err := New([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("failed to create resolver: %v", err)
+	}
+
+	tests := map[string]struct {
+		remote   string
+		headers  map[string]string
+		expected string
+	}{
+		"direct":            {"203.0.113.7:1234", nil, "203.0.113.7"},
+		"untrusted peer":    {"203.0.113.7:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		"trusted peer":      {"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "1.2.3.4"},
+		"spoofed chain":     {"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.2, 192.168.1.1"}, "198.51.100.2"},
+		"forwarded":         {"[fd00::1]:1234", map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https, for=10.0.0.2`, "X-Forwarded-For": "1.2.3.4"}, "2001:db8::1"},
+		"real ip":           {"192.168.1.1:1234", map[string]string{"X-Real-IP": "1.2.3.4"}, "1.2.3.4"},
+		"unknown forwarder": {"10.1.2.3:1234", map[string]string{"Forwarded": "for=unknown"}, "10.1.2.3"},
+	}
+
+	for name, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remote
+		for header, value := range test.headers {
+			r.Header.Set(header, value)
+		}
+
+		if actual := FromContext(res.Resolve(r).Context()); actual != test.expected {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, actual)
+		}
+	}
+}
+
+func TestResolveStripsUntrustedHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	r.Header.Set("Forwarded", "for=1.2.3.4")
+
+	var res *Resolver
+	r = res.Resolve(r)
+
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+		t.Errorf("expected forwarding headers from an untrusted peer to be removed, got %v", r.Header)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("expected an invalid range to be refused")
+	}
+
+	if _, err := New([]string{"proxy.example.org"}); err == nil {
+		t.Errorf("expected a host name to be refused")
+	}
+}
@@ -5,45 +5,308 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+	"github.com/renevo/gateway/metrics"
+	"github.com/renevo/gateway/requestid"
+	"github.com/renevo/gateway/server/cors"
+	"github.com/renevo/gateway/server/headers"
+	"github.com/renevo/gateway/server/openapi"
+	"github.com/renevo/gateway/server/proxy"
+	"github.com/renevo/gateway/server/realip"
 	"github.com/renevo/gateway/server/static"
+	"github.com/renevo/gateway/tracing"
+)
+
+const (
+	defaultReadHeaderTimeout = time.Second * 5
+	defaultReadTimeout       = time.Second * 30
+	defaultWriteTimeout      = time.Second * 30
+	defaultIdleTimeout       = time.Minute
 )
 
 // Server represents a gateway server instance
 type Server struct {
-	inner *http.Server
-	mux   *http.ServeMux // TODO: a better mux
-	site  *static.Site
+	handler        http.Handler
+	mux            *http.ServeMux // TODO: a better mux
+	site           *static.Site
+	errorPages     map[string]string
+	services       []*proxy.Service
+	contentTimeout time.Duration
+	cors           *cors.Policy
+	headers        *headers.Policy
+
+	forwardRequestID bool
+	trustRequestID   bool
+	realIP           *realip.Resolver
+	logRealIP        bool
+	metrics          []metrics.Recorder
+	tracer           *tracing.Tracer
+	specPath         string
+	specUI           string
+	spec             *openapi.Spec
+	upstreams        map[string]string
+
+	mu        sync.Mutex
+	closed    bool
+	servers   []*http.Server
+	listening []string
+}
+
+// Route describes a mounted path and the policies applied to it
+type Route struct {
+	Path       string        `json:"path"`
+	Backend    string        `json:"backend,omitempty"`
+	CORS       *cors.Options `json:"cors,omitempty"`
+	Validation openapi.Mode  `json:"validation,omitempty"`
+}
+
+// Upstream is the current state of a proxied backend service
+type Upstream struct {
+	Path        string            `json:"path"`
+	Backend     string            `json:"backend"`
+	Up          bool              `json:"up"`
+	State       string            `json:"state,omitempty"`
+	Transitions map[string]uint64 `json:"transitions,omitempty"`
+	Rejected    uint64            `json:"rejected"`
+	Retries     uint64            `json:"retries"`
+}
+
+// Timeouts are the connection deadlines for a single listener, any zero value will use the default
+type Timeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
 }
 
 // New creates a new server instance
 func New(options ...Option) *Server {
 	server := &Server{
-		mux:  http.NewServeMux(),
-		site: static.New("./public/www"),
-	}
-
-	server.inner = &http.Server{
-		Handler:           server,
-		IdleTimeout:       time.Minute,
-		ReadHeaderTimeout: time.Second,
-		ReadTimeout:       time.Second,
-		WriteTimeout:      time.Second,
+		mux:       http.NewServeMux(),
+		site:      static.New("./public/www"),
+		upstreams: make(map[string]string),
 	}
 
 	for _, opt := range options {
 		opt(server)
 	}
 
-	server.mux.Handle("/", server.site)
+	server.handler = server.mux
+	if server.headers != nil {
+		server.handler = server.headers.Handler(server.handler)
+	}
+
+	server.site.ErrorPages(server.errorPages)
+	server.mux.Handle("/", server.route(withDeadline(server.site, server.contentTimeout), server.cors))
+
+	for _, service := range server.services {
+		service.HandleErrors(server.ServeError)
+
+		policy := service.CORS()
+		if policy == nil {
+			policy = server.cors
+		}
+
+		var handler http.Handler = service
+		if server.spec != nil {
+			handler = server.spec.Validate(service.Path(), service.Validation(), handler)
+		}
+		handler = server.route(withDeadline(handler, service.ReadTimeout()), policy)
+
+		path := service.Path()
+		server.mux.Handle(path, handler)
+		if !strings.HasSuffix(path, "/") {
+			server.mux.Handle(path+"/", handler)
+		}
+
+		// keyed the same as the route of the requests it serves
+		if path != "/" {
+			path = strings.TrimSuffix(path, "/")
+		}
+		server.upstreams[path] = service.Target().Redacted()
+	}
+
+	if server.spec != nil {
+		var sources []openapi.Source
+		for _, service := range server.services {
+			if service.Spec() != "" {
+				sources = append(sources, openapi.Source{
+					Path:      service.Path(),
+					Target:    service.Target(),
+					Spec:      service.Spec(),
+					Transport: service.Transport(),
+				})
+			}
+		}
+		server.spec.Update(sources)
+	}
+
+	if server.spec != nil && server.specPath != "" {
+		var ui http.Handler
+		patterns := []string{"", ".json", ".yaml", ".yml"}
+		if server.specUI != "" {
+			// without the UI files, browsers are served the spec instead of being redirected to a missing page
+			if site := static.New(server.specUI); site.Err() != nil {
+				logging.Warnf("Swagger UI %s is not available, serving the spec to browsers: %v", server.specUI, site.Err())
+			} else {
+				ui = site
+				patterns = append(patterns, "/")
+			}
+		}
+
+		handler := server.route(server.spec.Handler(server.specPath, ui), server.cors)
+		for _, pattern := range patterns {
+			server.mux.Handle(server.specPath+pattern, handler)
+		}
+	}
 
 	return server
 }
 
+// route applies the policies to a mounted handler
+func (s *Server) route(h http.Handler, policy *cors.Policy) http.Handler {
+	if policy != nil {
+		h = policy.Handler(h, s.ServeError)
+	}
+
+	return h
+}
+
+// Routes returns the mounted paths and their effective policies
+func (s *Server) Routes() []Route {
+	routes := []Route{{Path: "/"}}
+	if s.cors != nil {
+		options := s.cors.Options()
+		routes[0].CORS = &options
+	}
+
+	for _, service := range s.services {
+		route := Route{
+			Path:       service.Path(),
+			Backend:    service.Target().Redacted(),
+			Validation: service.Validation(),
+		}
+
+		policy := service.CORS()
+		if policy == nil {
+			policy = s.cors
+		}
+
+		if policy != nil {
+			options := policy.Options()
+			route.CORS = &options
+		}
+
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// Listening returns the addresses of the listeners that are serving requests
+func (s *Server) Listening() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.listening...)
+}
+
+// ContentErr returns the error reading the static site content, nil when the content was loaded
+func (s *Server) ContentErr() error {
+	return s.site.Err()
+}
+
+// Upstreams returns the state of every proxied backend service, an upstream is up unless its circuit breaker is open
+func (s *Server) Upstreams() []Upstream {
+	upstreams := make([]Upstream, 0, len(s.services))
+	for _, service := range s.services {
+		upstream := Upstream{
+			Path:    service.Path(),
+			Backend: service.Target().Redacted(),
+			Up:      true,
+			Retries: service.Retries(),
+		}
+
+		if breaker := service.Breaker(); breaker != nil {
+			stats := breaker.Stats()
+			upstream.Up = stats.State != proxy.StateOpen
+			upstream.State = stats.State.String()
+			upstream.Rejected = stats.Rejected
+			upstream.Transitions = make(map[string]uint64, len(stats.Transitions))
+			for state, count := range stats.Transitions {
+				upstream.Transitions[state.String()] = count
+			}
+		}
+
+		upstreams = append(upstreams, upstream)
+	}
+
+	return upstreams
+}
+
+// Collect adds the upstream service and static content cache metrics to a Prometheus scrape
+func (s *Server) Collect(e *metrics.Exposition) {
+	for _, service := range s.services {
+		route := service.Path()
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+
+		e.Counter("gateway_upstream_retries_total", "Connection attempts to the upstream service that were retried.", float64(service.Retries()), "route", route)
+
+		up := 1.0
+		breaker := service.Breaker()
+		if breaker == nil {
+			e.Gauge("gateway_upstream_up", "Whether the upstream service is accepting requests (circuit breaker not open).", up, "route", route)
+			continue
+		}
+
+		stats := breaker.Stats()
+		if stats.State == proxy.StateOpen {
+			up = 0
+		}
+		e.Gauge("gateway_upstream_up", "Whether the upstream service is accepting requests (circuit breaker not open).", up, "route", route)
+		e.Counter("gateway_upstream_circuit_rejected_total", "Requests failed by an open circuit breaker.", float64(stats.Rejected), "route", route)
+
+		for _, state := range []proxy.State{proxy.StateClosed, proxy.StateOpen, proxy.StateHalfOpen} {
+			current := 0.0
+			if stats.State == state {
+				current = 1
+			}
+			e.Gauge("gateway_upstream_circuit_state", "Current circuit breaker state.", current, "route", route, "state", state.String())
+			e.Counter("gateway_upstream_circuit_transitions_total", "Circuit breaker transitions into each state.", float64(stats.Transitions[state]), "route", route, "state", state.String())
+		}
+	}
+
+	cache := s.site.CacheStats()
+	e.Gauge("gateway_static_cache_files", "Static content files held in memory.", float64(cache.Files))
+	e.Gauge("gateway_static_cache_bytes", "Static content bytes held in memory.", float64(cache.Bytes))
+	e.Counter("gateway_static_cache_hits_total", "Static content files served from memory.", float64(cache.Hits))
+	e.Counter("gateway_static_cache_misses_total", "Static content files read from disk.", float64(cache.Misses))
+}
+
+// ServeError writes a gateway generated error response using the custom error pages
+func (s *Server) ServeError(w http.ResponseWriter, r *http.Request, code int) {
+	s.site.ServeError(w, r, code)
+}
+
 // Listen will create a new listener and serve requests on it
-func (s *Server) Listen(addr *url.URL) error {
+func (s *Server) Listen(addr *url.URL, timeouts Timeouts) error {
+	ln, err := Bind(addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ln, timeouts)
+}
+
+// Bind creates the listener for the address, so binding can fail before requests are served (e.g. before notifying systemd)
+func Bind(addr *url.URL) (net.Listener, error) {
 	network := addr.Scheme
 	if network == "" {
 		network = "tcp"
@@ -55,47 +318,211 @@ func (s *Server) Listen(addr *url.URL) error {
 		port = "80"
 	}
 
-	ln, err := net.Listen(network, address+":"+port)
-	if err != nil {
-		return err
+	return net.Listen(network, address+":"+port)
+}
+
+// Serve serves requests on a listener created with Bind, until the server is shutdown
+func (s *Server) Serve(ln net.Listener, timeouts Timeouts) error {
+	inner := &http.Server{
+		Handler:           s,
+		IdleTimeout:       orDefault(timeouts.Idle, defaultIdleTimeout),
+		ReadHeaderTimeout: orDefault(timeouts.ReadHeader, defaultReadHeaderTimeout),
+		ReadTimeout:       orDefault(timeouts.Read, defaultReadTimeout),
+		WriteTimeout:      orDefault(timeouts.Write, defaultWriteTimeout),
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return http.ErrServerClosed
 	}
+	s.servers = append(s.servers, inner)
+	s.listening = append(s.listening, ln.Addr().String())
+	s.mu.Unlock()
 
 	logging.Infof("Serving HTTP requests on %s", ln.Addr())
-	return s.inner.Serve(tcpKeepAliveListener{ln.(*net.TCPListener), s.inner.IdleTimeout})
+	return inner.Serve(tcpKeepAliveListener{ln.(*net.TCPListener), inner.IdleTimeout})
 }
 
 // ServeHTTP is the core HTTP handler for the gateway
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
+
+	id := r.Header.Get(requestid.Header)
+	if !s.trustRequestID || !requestid.Valid(id) {
+		id = requestid.New()
+	}
+	r = r.WithContext(requestid.NewContext(r.Context(), id))
+
+	if s.forwardRequestID {
+		r.Header.Set(requestid.Header, id)
+	} else {
+		// the client id isn't the one logged, so it isn't passed on to the backend either
+		r.Header.Del(requestid.Header)
+	}
+
+	r = s.realIP.Resolve(r)
+
+	route := s.routePath(r)
+	for _, recorder := range s.metrics {
+		if tracker, ok := recorder.(metrics.Tracker); ok {
+			tracker.Started(route)
+		}
+	}
+
+	span := s.tracer.Start(r.Method+" "+route, r.Header)
+	if span != nil {
+		r = r.WithContext(tracing.NewContext(r.Context(), span))
+	}
+
 	stats := &responseWriterStats{inner: w}
-	s.mux.ServeHTTP(stats, r)
-	logging.Infof("HTTP %s %s %q %q %s %d %d", r.Method, r.RemoteAddr, r.RequestURI, r.UserAgent(), time.Since(start), stats.code, stats.size)
+	defer func() {
+		// an aborted response (e.g. the proxy panics with http.ErrAbortHandler when the client or backend goes away) is still
+		// logged and recorded, so the trackers see it end
+		aborted := recover()
+
+		entry := s.accessEntry(r, stats, start)
+		entry.Route = route
+		entry.Upstream = s.upstreams[route]
+		logging.Access(entry)
+
+		if span != nil {
+			endSpan(span, entry)
+		}
+
+		for _, recorder := range s.metrics {
+			recorder.Record(entry)
+		}
+
+		if aborted != nil {
+			panic(aborted)
+		}
+	}()
+
+	s.handler.ServeHTTP(stats, r)
 }
 
-// Shutdown will gracefully shutdown the server, finishing any finalized requests
-func (s *Server) Shutdown(ctx context.Context) error {
-	return s.inner.Shutdown(ctx)
+// endSpan describes the completed request with the OpenTelemetry HTTP server attributes
+func endSpan(span *tracing.Span, e *access.Entry) {
+	span.SetAttribute("http.request.method", e.Method)
+	span.SetAttribute("http.route", e.Route)
+	span.SetAttribute("url.path", strings.SplitN(e.URI, "?", 2)[0])
+	span.SetAttribute("server.address", e.Host)
+	span.SetAttribute("client.address", e.RemoteAddr)
+	span.SetAttribute("user_agent.original", e.UserAgent)
+	span.SetAttribute("http.response.status_code", e.Status)
+	span.SetAttribute("http.response.body.size", e.Size)
+	span.SetAttribute("gateway.request_id", e.RequestID)
+	if e.Upstream != "" {
+		span.SetAttribute("gateway.upstream", e.Upstream)
+	}
+
+	if e.Status >= 500 {
+		span.Fail(http.StatusText(e.Status))
+	}
+
+	span.End()
 }
 
-type responseWriterStats struct {
-	inner http.ResponseWriter
-	code  int
-	size  int
+// accessEntry describes the completed request for the access log
+func (s *Server) accessEntry(r *http.Request, stats *responseWriterStats, start time.Time) *access.Entry {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if s.logRealIP {
+		remote = realip.FromContext(r.Context())
+	}
+
+	user, _, _ := r.BasicAuth()
+
+	// nothing written is still sent as a 200 by the http server
+	status := stats.code
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return &access.Entry{
+		Time:       start,
+		RemoteAddr: remote,
+		User:       user,
+		Method:     r.Method,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		Host:       r.Host,
+		Status:     status,
+		Size:       stats.size,
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		Duration:   time.Since(start),
+		RequestID:  requestid.FromContext(r.Context()),
+	}
 }
 
-func (r *responseWriterStats) Header() http.Header {
-	return r.inner.Header()
+// routePath returns the mounted path that served the request
+func (s *Server) routePath(r *http.Request) string {
+	_, pattern := s.mux.Handler(r)
+	if pattern != "/" {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	return pattern
 }
 
-func (r *responseWriterStats) Write(v []byte) (int, error) {
-	size, err := r.inner.Write(v)
-	r.size += size
-	return size, err
+// Shutdown will gracefully shutdown the server, finishing any finalized requests
+//
+// Upgraded connections (e.g. WebSockets) are not tracked by the http server, so they are closed once it has shutdown
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	servers := s.servers
+	s.mu.Unlock()
+
+	var err error
+	for _, inner := range servers {
+		if serr := inner.Shutdown(ctx); serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	if s.spec != nil {
+		s.spec.Close()
+	}
+
+	for _, service := range s.services {
+		if serr := service.Shutdown(ctx); serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	return err
 }
 
-func (r *responseWriterStats) WriteHeader(code int) {
-	r.code = code
-	r.inner.WriteHeader(code)
+// withDeadline extends the connection deadlines for requests served by the handler
+//
+// This allows routes to have longer (or shorter) limits than the listener they were received on
+func withDeadline(h http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline := time.Now().Add(timeout)
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(deadline)
+		rc.SetWriteDeadline(deadline)
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func orDefault(value, fallback time.Duration) time.Duration {
+	if value == 0 {
+		return fallback
+	}
+
+	return value
 }
 
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
@@ -0,0 +1,90 @@
+package static
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/renevo/gateway/logging"
+)
+
+// ErrorPages will load the custom error pages keyed by status code (401) or wildcard (4xx, 5xx, error)
+//
+// Any page not configured here will be looked up in the site content as <code>.html, <class>xx.html, then error.html
+func (s *Site) ErrorPages(pages map[string]string) {
+	s.errors = make(map[string][]byte, len(pages))
+
+	for key, path := range pages {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			logging.Errorf("Failed to read error page %q for %s: %v", path, key, err)
+			continue
+		}
+
+		s.errors[strings.ToLower(key)] = contents
+	}
+}
+
+// ServeError will write a gateway generated error response for the status code
+//
+// JSON requests will receive a JSON error body, all others will receive the most specific error page available
+func (s *Site) ServeError(w http.ResponseWriter, r *http.Request, code int) {
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(struct {
+			Status int    `json:"status"`
+			Error  string `json:"error"`
+		}{code, http.StatusText(code)})
+		return
+	}
+
+	page := s.errorPage(code)
+	if page == nil {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(page)
+}
+
+func (s *Site) errorPage(code int) []byte {
+	status := strconv.Itoa(code)
+	keys := []string{status, status[:1] + "xx", "error"}
+
+	for _, key := range keys {
+		if page, found := s.errors[key]; found {
+			return page
+		}
+	}
+
+	if s.fs == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		f, err := s.fs.Open(fmt.Sprintf("/%s.html", key))
+		if err != nil {
+			continue
+		}
+
+		page, err := ioutil.ReadAll(f)
+		f.Close()
+		if err == nil {
+			return page
+		}
+	}
+
+	return nil
+}
+
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
@@ -54,10 +54,15 @@ func (m *fileInfo) Sys() interface{} {
 	return nil
 }
 
+// inMemory returns false for files too large to be kept in memory, those are opened from disk
+func (m *fileInfo) inMemory() bool {
+	return m.size == 0 || len(m.contents) > 0
+}
+
 func (m *fileInfo) Open() (http.File, error) {
 	logging.Debugf("Memory: Opening File: %q", m.name)
 
-	if m.size > 0 && len(m.contents) == 0 {
+	if !m.inMemory() {
 		logging.Debugf("Memory: Opening File From FS: %s", m.fsPath)
 		return os.Open(m.fsPath)
 	}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/renevo/gateway/env"
 	"github.com/renevo/gateway/logging"
@@ -21,6 +22,22 @@ type siteFS struct {
 	http.FileSystem
 	root  string
 	files sync.Map
+
+	// cache statistics, memory files and bytes are only written while loading
+	memoryFiles int64
+	memoryBytes int64
+	hits        uint64
+	misses      uint64
+}
+
+// CacheStats is a point in time snapshot of the in memory file cache
+type CacheStats struct {
+	// Files and Bytes held in memory
+	Files int64
+	Bytes int64
+	// Hits are files served from memory, Misses are files read from disk
+	Hits   uint64
+	Misses uint64
 }
 
 func dir(path string) (*siteFS, error) {
@@ -94,6 +111,8 @@ func (fs *siteFS) add(maxSize int64, fsPath string, info os.FileInfo) error {
 	}
 
 	// store it for later
+	fs.memoryFiles++
+	fs.memoryBytes += int64(len(contents))
 	fs.files.Store(urlPath, &fileInfo{
 		contents: contents,
 		fsPath:   absPath,
@@ -120,12 +139,27 @@ func (fs *siteFS) Open(name string) (http.File, error) {
 	mf := fs.lookup(name)
 	if mf != nil {
 		logging.Debugf("OpenMemoryFile: %q", name)
+		if mf.inMemory() {
+			atomic.AddUint64(&fs.hits, 1)
+		} else {
+			atomic.AddUint64(&fs.misses, 1)
+		}
 		return mf.Open()
 	}
 
+	atomic.AddUint64(&fs.misses, 1)
 	f, err := fs.FileSystem.Open(name)
 
 	logging.Debugf("OpenFile: %q: %v", name, err)
 
 	return f, err
 }
+
+func (fs *siteFS) stats() CacheStats {
+	return CacheStats{
+		Files:  fs.memoryFiles,
+		Bytes:  fs.memoryBytes,
+		Hits:   atomic.LoadUint64(&fs.hits),
+		Misses: atomic.LoadUint64(&fs.misses),
+	}
+}
@@ -2,9 +2,14 @@ package static
 
 import (
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
 
 	"github.com/renevo/gateway/env"
 	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/server/headers"
 )
 
 const (
@@ -16,6 +21,9 @@ const (
 type Site struct {
 	handler http.Handler
 	fs      http.FileSystem
+	root    string
+	errors  map[string][]byte
+	err     error
 }
 
 // New creates a new static.Site
@@ -24,9 +32,16 @@ type Site struct {
 func New(path string) *Site {
 	if env.Bool(envBypassMemory) {
 		fs := http.Dir(path)
+		_, err := os.Stat(path)
+		if err != nil {
+			logging.Errorf("Failed to read site path %q: %v", path, err)
+		}
+
 		return &Site{
 			handler: http.FileServer(fs),
 			fs:      fs,
+			root:    path,
+			err:     err,
 		}
 	}
 
@@ -40,7 +55,23 @@ func New(path string) *Site {
 	return &Site{
 		handler: http.FileServer(fs),
 		fs:      fs,
+		root:    path,
+		err:     err,
+	}
+}
+
+// Err returns the error reading the site content, nil when the content was loaded
+func (s *Site) Err() error {
+	return s.err
+}
+
+// CacheStats returns the in memory file cache statistics, all zero when the cache is disabled
+func (s *Site) CacheStats() CacheStats {
+	if fs, ok := s.fs.(*siteFS); ok {
+		return fs.stats()
 	}
+
+	return CacheStats{}
 }
 
 // ServeHTTP is the HTTP handler for the static web site
@@ -48,6 +79,39 @@ func (s *Site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// TODO: default document (override the base code)
 	// TODO: spa mode, if not found locally, serve the default document
 	//		 this might require storing directories in the fs as well
+	if headers.Debugging(r.Context()) {
+		if fsPath, modified, found := s.content(r.URL.Path); found {
+			headers.SetContent(r.Context(), fsPath, modified)
+		}
+	}
+
 	s.handler.ServeHTTP(w, r)
 	return
 }
+
+// content returns the path on disk and modified time of the file that will serve the url path
+func (s *Site) content(urlPath string) (string, time.Time, bool) {
+	urlPath = path.Clean("/" + urlPath)
+
+	f, err := s.fs.Open(urlPath)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	if info.IsDir() {
+		return s.content(path.Join(urlPath, "index.html"))
+	}
+
+	if mf, ok := info.(*fileInfo); ok {
+		return mf.fsPath, mf.modified, true
+	}
+
+	absPath, _ := filepath.Abs(filepath.Join(s.root, filepath.FromSlash(urlPath)))
+	return absPath, info.ModTime(), true
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriterStats records the status and size of a response for the access logs
+//
+// All of the optional http.ResponseWriter interfaces are implemented so that streaming, upgrades, push, and sendfile
+// keep working through the wrapper. When the underlying writer doesn't support one, http.ErrNotSupported is returned.
+type responseWriterStats struct {
+	inner    http.ResponseWriter
+	code     int
+	size     int64
+	hijacked bool
+}
+
+func (r *responseWriterStats) Header() http.Header {
+	return r.inner.Header()
+}
+
+func (r *responseWriterStats) Write(v []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+
+	size, err := r.inner.Write(v)
+	r.size += int64(size)
+	return size, err
+}
+
+func (r *responseWriterStats) WriteHeader(code int) {
+	// informational responses (e.g. 103 Early Hints) are not the final status
+	if code >= http.StatusOK || code == http.StatusSwitchingProtocols {
+		r.code = code
+	}
+	r.inner.WriteHeader(code)
+}
+
+// Flush sends any buffered data to the client
+func (r *responseWriterStats) Flush() {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+
+	if f, ok := r.inner.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection, the response is recorded as switching protocols
+func (r *responseWriterStats) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.inner.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		r.hijacked = true
+		if r.code == 0 {
+			r.code = http.StatusSwitchingProtocols
+		}
+	}
+
+	return conn, rw, err
+}
+
+// Push initiates an HTTP/2 server push
+func (r *responseWriterStats) Push(target string, opts *http.PushOptions) error {
+	if p, ok := r.inner.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// ReadFrom allows the underlying connection to use sendfile when serving files
+func (r *responseWriterStats) ReadFrom(src io.Reader) (int64, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+
+	if rf, ok := r.inner.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(src)
+		r.size += n
+		return n, err
+	}
+
+	// hide ReadFrom from io.Copy so it doesn't recurse back into this method
+	return io.Copy(struct{ io.Writer }{r}, src)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying connection
+func (r *responseWriterStats) Unwrap() http.ResponseWriter {
+	return r.inner
+}
@@ -0,0 +1,167 @@
+package systemd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+)
+
+// journalSocket is where journald accepts native protocol messages
+const journalSocket = "/run/systemd/journal/socket"
+
+// sd-daemon priorities
+const (
+	priorityError   = 3
+	priorityWarning = 4
+	priorityInfo    = 6
+	priorityDebug   = 7
+)
+
+// Stream writes the access and application logs to a single writer with sd-daemon <N> priority prefixes
+//
+// Access logs are written at INFO (6) and application logs at DEBUG (7), warnings and errors at WARNING (4) and ERR (3).
+type Stream struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format access.Formatter
+}
+
+// NewStream creates the prefixed output, this is usually os.Stdout which systemd connects to the journal
+func NewStream(out io.Writer, format access.Formatter) *Stream {
+	return &Stream{out: out, format: format}
+}
+
+func (s *Stream) Access(e *access.Entry) {
+	s.write(accessPriority(e), s.format(e))
+}
+
+func (s *Stream) Log(m *logging.Message) {
+	msg := m.Text
+	if m.RequestID != "" {
+		msg = "[" + m.RequestID + "] " + msg
+	}
+
+	s.write(messagePriority(m), []byte(msg))
+}
+
+func (s *Stream) write(priority int, msg []byte) {
+	var buf bytes.Buffer
+	// every line needs the prefix, otherwise continuation lines are logged at the default priority
+	for _, line := range bytes.Split(msg, []byte("\n")) {
+		buf.WriteString("<" + strconv.Itoa(priority) + ">")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	s.out.Write(buf.Bytes())
+	s.mu.Unlock()
+}
+
+// Journal sends the access and application logs to journald with the native protocol, keeping the request details as fields
+type Journal struct {
+	conn   *net.UnixConn
+	addr   *net.UnixAddr
+	format access.Formatter
+}
+
+// NewJournal connects to the journald socket
+func NewJournal(format access.Formatter) (*Journal, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		conn:   conn,
+		addr:   &net.UnixAddr{Name: journalSocket, Net: "unixgram"},
+		format: format,
+	}, nil
+}
+
+func (j *Journal) Access(e *access.Entry) {
+	j.send([][2]string{
+		{"MESSAGE", string(j.format(e))},
+		{"PRIORITY", strconv.Itoa(accessPriority(e))},
+		{"SYSLOG_IDENTIFIER", "gateway"},
+		{"REQUEST_ID", e.RequestID},
+		{"REQUEST_METHOD", e.Method},
+		{"REQUEST_URI", e.URI},
+		{"REMOTE_ADDR", e.RemoteAddr},
+		{"STATUS", strconv.Itoa(e.Status)},
+		{"DURATION", e.Duration.String()},
+	})
+}
+
+func (j *Journal) Log(m *logging.Message) {
+	j.send([][2]string{
+		{"MESSAGE", m.Text},
+		{"PRIORITY", strconv.Itoa(messagePriority(m))},
+		{"SYSLOG_IDENTIFIER", "gateway"},
+		{"REQUEST_ID", m.RequestID},
+	})
+}
+
+// Close closes the connection to journald
+func (j *Journal) Close() error {
+	return j.conn.Close()
+}
+
+func (j *Journal) send(fields [][2]string) {
+	if _, _, err := j.conn.WriteMsgUnix(journalMessage(fields), nil, j.addr); err != nil {
+		// the logs can't be used to report a failure to write the logs
+		fmt.Fprintf(os.Stderr, "journal: failed to send message: %v\n", err)
+	}
+}
+
+// journalMessage encodes the fields in the native journal protocol, empty fields are left out
+//
+// Values containing a new line are written as the name, a new line, the little endian 64bit length, and the value.
+func journalMessage(fields [][2]string) []byte {
+	var buf bytes.Buffer
+	for _, field := range fields {
+		name, value := field[0], field[1]
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "\n") {
+			buf.WriteString(name + "=" + value + "\n")
+			continue
+		}
+
+		buf.WriteString(name + "\n")
+		binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+func accessPriority(e *access.Entry) int {
+	if e.Status >= 500 {
+		return priorityError
+	}
+
+	return priorityInfo
+}
+
+func messagePriority(m *logging.Message) int {
+	switch m.Level {
+	case logging.LevelError:
+		return priorityError
+	case logging.LevelWarn:
+		return priorityWarning
+	}
+
+	return priorityDebug
+}
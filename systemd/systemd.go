@@ -0,0 +1,70 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Detected returns true when the process was started by systemd with its output connected to the journal
+func Detected() bool {
+	return os.Getenv("INVOCATION_ID") != "" || os.Getenv("JOURNAL_STREAM") != ""
+}
+
+// Notify sends a state change (e.g. READY=1) to the service manager, when not started with Type=notify this does nothing
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// sockets in the abstract namespace start with @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchdogInterval returns how often the service manager expects WATCHDOG=1, zero when the watchdog is disabled
+//
+// The interval is half of WatchdogSec so that a single late notification doesn't restart the service.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// Watchdog sends WATCHDOG=1 at the interval until stop is closed
+func Watchdog(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			Notify("WATCHDOG=1")
+		case <-stop:
+			return
+		}
+	}
+}
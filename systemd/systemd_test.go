@@ -0,0 +1,88 @@
+package systemd
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+	"github.com/renevo/gateway/logging/access"
+)
+
+func TestNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+	if err := Notify("READY=1"); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read notification: %v", err)
+	}
+
+	if state := string(buf[:n]); state != "READY=1" {
+		t.Errorf("expected READY=1, got %q", state)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	if interval := WatchdogInterval(); interval != time.Second*15 {
+		t.Errorf("expected half of the watchdog timeout, got %s", interval)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if interval := WatchdogInterval(); interval != 0 {
+		t.Errorf("expected the watchdog of another process to be ignored, got %s", interval)
+	}
+}
+
+func TestStreamPriorities(t *testing.T) {
+	var out bytes.Buffer
+	s := NewStream(&out, access.Common)
+
+	s.Log(&logging.Message{Level: logging.LevelInfo, RequestID: "abc-123", Text: "first\nsecond"})
+	s.Log(&logging.Message{Level: logging.LevelError, Text: "failed"})
+	s.Access(&access.Entry{
+		Time:       time.Date(2017, 10, 10, 8, 0, 0, 0, time.UTC),
+		RemoteAddr: "127.0.0.1",
+		Method:     "GET",
+		URI:        "/",
+		Proto:      "HTTP/1.1",
+		Status:     200,
+	})
+
+	expected := "<7>[abc-123] first\n<7>second\n<3>failed\n" +
+		"<6>127.0.0.1 - - [10/Oct/2017:08:00:00 +0000] \"GET / HTTP/1.1\" 200 -\n"
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestJournalMessage(t *testing.T) {
+	message := journalMessage([][2]string{
+		{"MESSAGE", "multi\nline"},
+		{"PRIORITY", "6"},
+		{"REQUEST_ID", ""},
+	})
+
+	expected := "MESSAGE\n\x0a\x00\x00\x00\x00\x00\x00\x00multi\nline\nPRIORITY=6\n"
+	if string(message) != expected {
+		t.Errorf("expected %q, got %q", expected, message)
+	}
+}
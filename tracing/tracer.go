@@ -0,0 +1,302 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/renevo/gateway/logging"
+)
+
+const (
+	defaultInterval = time.Second * 5
+
+	// queueSize is how many ended spans can wait to be sent before new spans are dropped
+	queueSize = 2048
+
+	// maxBatch is the most spans sent in a single request to the collector
+	maxBatch = 512
+
+	exportTimeout = time.Second * 10
+	closeTimeout  = time.Second * 5
+)
+
+// Options defines the service being traced and where the spans are sent
+type Options struct {
+	// Endpoint is the OTLP/HTTP collector address, /v1/traces is used when it has no path
+	Endpoint *url.URL
+	// ServiceName is the service.name resource attribute, defaults to gateway
+	ServiceName string
+	// Version is the service.version resource attribute
+	Version string
+	// Interval between sending the ended spans, defaults to 5s
+	Interval time.Duration
+}
+
+// Tracer starts spans and sends them to an OpenTelemetry collector using OTLP/HTTP (JSON)
+//
+// Spans are sent in the background, when the collector can't keep up spans are dropped.
+type Tracer struct {
+	endpoint string
+	resource []attribute
+	interval time.Duration
+	client   *http.Client
+
+	spans chan *Span
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// New creates the tracer and starts sending spans at the interval
+func New(options Options) (*Tracer, error) {
+	if options.Endpoint == nil || options.Endpoint.Host == "" {
+		return nil, fmt.Errorf("tracing collector address is required")
+	}
+
+	if options.Endpoint.Scheme != "http" && options.Endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported tracing collector scheme %q", options.Endpoint.Scheme)
+	}
+
+	endpoint := *options.Endpoint
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/traces"
+	}
+
+	if options.ServiceName == "" {
+		options.ServiceName = "gateway"
+	}
+
+	if options.Interval <= 0 {
+		options.Interval = defaultInterval
+	}
+
+	resource := []attribute{{"service.name", options.ServiceName}}
+	if options.Version != "" {
+		resource = append(resource, attribute{"service.version", options.Version})
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		resource = append(resource, attribute{"host.name", hostname})
+	}
+
+	t := &Tracer{
+		endpoint: endpoint.String(),
+		resource: resource,
+		interval: options.Interval,
+		client:   &http.Client{Timeout: exportTimeout},
+		spans:    make(chan *Span, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go t.run()
+
+	return t, nil
+}
+
+// Start starts a server span for an incoming request, continuing the trace from the traceparent header when there is one
+func (t *Tracer) Start(name string, h http.Header) *Span {
+	if t == nil {
+		return nil
+	}
+
+	if p, ok := parseTraceparent(h.Get(Header)); ok {
+		return t.start(name, KindServer, p.traceID, p.id, p.sampled, h.Get(stateHeader))
+	}
+
+	var traceID TraceID
+	randomID(traceID[:])
+	return t.start(name, KindServer, traceID, SpanID{}, true, "")
+}
+
+func (t *Tracer) start(name string, kind Kind, traceID TraceID, parent SpanID, sampled bool, state string) *Span {
+	s := &Span{
+		tracer:  t,
+		traceID: traceID,
+		parent:  parent,
+		sampled: sampled,
+		state:   state,
+		name:    name,
+		kind:    kind,
+		start:   time.Now(),
+	}
+	randomID(s.id[:])
+
+	return s
+}
+
+func (t *Tracer) export(s *Span) {
+	select {
+	case t.spans <- s:
+	default:
+	}
+}
+
+// Close sends the ended spans and stops the tracer
+func (t *Tracer) Close() error {
+	close(t.stop)
+
+	select {
+	case <-t.done:
+		return nil
+	case <-time.After(closeTimeout):
+		return fmt.Errorf("timed out sending spans to %s", t.endpoint)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case s := <-t.spans:
+			if batch = append(batch, s); len(batch) >= maxBatch {
+				t.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.send(batch)
+			batch = nil
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.spans:
+					batch = append(batch, s)
+				default:
+					t.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(t.request(batch))
+	if err != nil {
+		logging.Debugf("Failed to encode spans: %v", err)
+		return
+	}
+
+	res, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logging.Debugf("Failed to send spans to %s: %v", t.endpoint, err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		logging.Debugf("Failed to send spans to %s: %s", t.endpoint, res.Status)
+	}
+}
+
+// OTLP JSON encoding of an ExportTraceServiceRequest, ids are hex and 64 bit integers are strings
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource struct {
+		Attributes []keyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type scopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	TraceState        string     `json:"traceState,omitempty"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              Kind       `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            *status    `json:"status,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (t *Tracer) request(batch []*Span) exportRequest {
+	var rs resourceSpans
+	rs.Resource.Attributes = keyValues(t.resource)
+
+	var ss scopeSpans
+	ss.Scope.Name = "github.com/renevo/gateway"
+
+	for _, s := range batch {
+		s.mu.Lock()
+		encoded := span{
+			TraceID:           s.traceID.String(),
+			SpanID:            s.id.String(),
+			TraceState:        s.state,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        keyValues(s.attributes),
+		}
+		if s.parent != (SpanID{}) {
+			encoded.ParentSpanID = s.parent.String()
+		}
+		if s.failed {
+			encoded.Status = &status{Code: 2, Message: s.message}
+		}
+		s.mu.Unlock()
+
+		ss.Spans = append(ss.Spans, encoded)
+	}
+
+	rs.ScopeSpans = []scopeSpans{ss}
+	return exportRequest{ResourceSpans: []resourceSpans{rs}}
+}
+
+func keyValues(attributes []attribute) []keyValue {
+	values := make([]keyValue, 0, len(attributes))
+	for _, a := range attributes {
+		var value map[string]interface{}
+		switch v := a.value.(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		values = append(values, keyValue{Key: a.key, Value: value})
+	}
+
+	return values
+}
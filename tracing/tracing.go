@@ -0,0 +1,230 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the W3C trace context header
+const Header = "traceparent"
+
+// stateHeader is the vendor specific trace context, passed on as is
+const stateHeader = "tracestate"
+
+// Kind is the relationship of a span to its parent and children
+type Kind int
+
+// span kinds, as numbered by OTLP
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// Span is a single timed operation within a trace
+//
+// All methods are safe to call on a nil span, so code can trace requests without checking if tracing is enabled.
+type Span struct {
+	tracer *Tracer
+
+	traceID TraceID
+	id      SpanID
+	parent  SpanID
+	sampled bool
+	state   string
+	name    string
+	kind    Kind
+	start   time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []attribute
+	failed     bool
+	message    string
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+type spanKey struct{}
+
+// NewContext returns a context with the span
+func NewContext(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext returns the span from the context, nil when the request is not traced
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// TraceID returns the id of the trace the span is part of
+func (s *Span) TraceID() TraceID {
+	if s == nil {
+		return TraceID{}
+	}
+	return s.traceID
+}
+
+// ID returns the id of the span
+func (s *Span) ID() SpanID {
+	if s == nil {
+		return SpanID{}
+	}
+	return s.id
+}
+
+// Child starts a span within this span
+func (s *Span) Child(name string, kind Kind) *Span {
+	if s == nil {
+		return nil
+	}
+
+	return s.tracer.start(name, kind, s.traceID, s.id, s.sampled, s.state)
+}
+
+// SetAttribute sets an attribute of the span, values are strings, bools, ints or float64s
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.attributes {
+		if s.attributes[i].key == key {
+			s.attributes[i].value = value
+			return
+		}
+	}
+	s.attributes = append(s.attributes, attribute{key, value})
+}
+
+// Fail marks the operation as failed
+func (s *Span) Fail(message string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.failed, s.message = true, message
+	s.mu.Unlock()
+}
+
+// End completes the span, sending it to the collector when the trace is sampled
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sampled {
+		s.tracer.export(s)
+	}
+}
+
+// Inject sets the trace context headers so the span is the parent of the spans of the receiver
+func (s *Span) Inject(h http.Header) {
+	if s == nil {
+		return
+	}
+
+	h.Set(Header, s.traceparent())
+	if s.state != "" {
+		h.Set(stateHeader, s.state)
+	} else {
+		h.Del(stateHeader)
+	}
+}
+
+func (s *Span) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+
+	return "00-" + s.traceID.String() + "-" + s.id.String() + "-" + flags
+}
+
+// parent is an incoming trace context
+type parent struct {
+	traceID TraceID
+	id      SpanID
+	sampled bool
+}
+
+// parseTraceparent parses a version 00 traceparent header (or any later version, using the version 00 fields)
+func parseTraceparent(value string) (parent, bool) {
+	var p parent
+
+	fields := strings.Split(strings.TrimSpace(value), "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || fields[0] == "ff" || (fields[0] == "00" && len(fields) != 4) {
+		return p, false
+	}
+
+	if len(fields[1]) != 32 || len(fields[2]) != 16 || len(fields[3]) != 2 || !lowerHex(strings.Join(fields[:4], "")) {
+		return p, false
+	}
+
+	if _, err := hex.Decode(p.traceID[:], []byte(fields[1])); err != nil || p.traceID == (TraceID{}) {
+		return p, false
+	}
+
+	if _, err := hex.Decode(p.id[:], []byte(fields[2])); err != nil || p.id == (SpanID{}) {
+		return p, false
+	}
+
+	flags, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return p, false
+	}
+	p.sampled = flags&1 == 1
+
+	return p, true
+}
+
+func lowerHex(value string) bool {
+	for _, r := range value {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomID(b []byte) {
+	for {
+		rand.Read(b)
+		for _, v := range b {
+			if v != 0 {
+				return
+			}
+		}
+	}
+}
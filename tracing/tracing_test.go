@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false, false},
+		{"", false, false},
+	}
+
+	for _, tt := range tests {
+		p, ok := parseTraceparent(tt.value)
+		if ok != tt.valid || p.sampled != tt.sampled {
+			t.Errorf("%q: expected valid %v sampled %v, got %v %v", tt.value, tt.valid, tt.sampled, ok, p.sampled)
+		}
+	}
+}
+
+func TestNilSpan(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.Start("GET /", http.Header{})
+
+	h := http.Header{}
+	span.Child("child", KindClient).SetAttribute("key", "value")
+	span.Fail("failed")
+	span.Inject(h)
+	span.End()
+
+	if span != nil || len(h) != 0 {
+		t.Errorf("expected a nil span to do nothing, got %v %v", span, h)
+	}
+}
+
+func TestTracerExportsToCollector(t *testing.T) {
+	requests := make(chan exportRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected export request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		var req exportRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid export request: %v", err)
+		}
+		requests <- req
+	}))
+	defer collector.Close()
+
+	endpoint, _ := url.Parse(collector.URL)
+	tracer, err := New(Options{Endpoint: endpoint, Version: "1.0.0"})
+	if err != nil {
+		t.Fatalf("failed to create tracer: %v", err)
+	}
+
+	incoming := http.Header{}
+	incoming.Set(Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Set(stateHeader, "vendor=value")
+
+	server := tracer.Start("GET /api", incoming)
+	client := server.Child("GET", KindClient)
+	client.SetAttribute("http.response.status_code", 502)
+	client.Fail("502 Bad Gateway")
+
+	outgoing := http.Header{}
+	client.Inject(outgoing)
+	if expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + client.ID().String() + "-01"; outgoing.Get(Header) != expected {
+		t.Errorf("expected traceparent %q, got %q", expected, outgoing.Get(Header))
+	}
+
+	if outgoing.Get(stateHeader) != "vendor=value" {
+		t.Errorf("expected the tracestate to be passed on, got %q", outgoing.Get(stateHeader))
+	}
+
+	client.End()
+	server.End()
+	tracer.Close()
+
+	req := <-requests
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected export request: %+v", req)
+	}
+
+	if attributes := req.ResourceSpans[0].Resource.Attributes; attributes[0].Value["stringValue"] != "gateway" {
+		t.Errorf("expected the gateway service name, got %+v", attributes)
+	}
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	c, s := spans[0], spans[1]
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID != "00f067aa0ba902b7" || s.Kind != KindServer {
+		t.Errorf("expected the server span to continue the incoming trace, got %+v", s)
+	}
+
+	if c.ParentSpanID != s.SpanID || c.Kind != KindClient || c.Status == nil || c.Status.Code != 2 {
+		t.Errorf("expected a failed client span within the server span, got %+v", c)
+	}
+
+	if c.Attributes[0].Value["intValue"] != "502" || !strings.HasPrefix(c.StartTimeUnixNano, "1") {
+		t.Errorf("unexpected client span encoding: %+v", c)
+	}
+}
+
+func TestUnsampledTraceIsNotExported(t *testing.T) {
+	exported := make(chan struct{}, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exported <- struct{}{}
+	}))
+	defer collector.Close()
+
+	endpoint, _ := url.Parse(collector.URL)
+	tracer, _ := New(Options{Endpoint: endpoint})
+
+	incoming := http.Header{}
+	incoming.Set(Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	tracer.Start("GET /", incoming).End()
+	tracer.Close()
+
+	select {
+	case <-exported:
+		t.Error("expected the unsampled span not to be sent")
+	default:
+	}
+}